@@ -2,6 +2,7 @@ package pusher
 
 import (
 	"github.com/Lupino/pusher/utils"
+	"github.com/gorilla/mux"
 	"net/http"
 	"strconv"
 	"time"
@@ -10,10 +11,15 @@ import (
 // Auth pusher api request
 func (s SPusher) Auth(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
 	var appKey = req.Header.Get("X-App-Key")
-	if s.key != appKey {
+	key, ok := s.getKey(appKey)
+	if !ok {
 		sendJSONResponse(rw, http.StatusBadRequest, "err", "Invalid X-App-Key")
 		return
 	}
+	if key.Revoked || key.Expired() {
+		sendJSONResponse(rw, http.StatusUnauthorized, "err", "Revoked or expired X-App-Key")
+		return
+	}
 	var timestamp = req.Header.Get("X-Request-Time")
 	var unixTimestamp, _ = strconv.ParseInt(timestamp, 10, 0)
 	var reqTime = time.Unix(unixTimestamp, 0)
@@ -21,13 +27,88 @@ func (s SPusher) Auth(rw http.ResponseWriter, req *http.Request, next http.Handl
 	if took < 0 {
 		took = -took
 	}
-	if took > 10*time.Minute {
+	if took > requestWindow {
 		sendJSONResponse(rw, http.StatusBadRequest, "err", "Invalid X-Request-Time")
 		return
 	}
 
+	switch {
+	case req.Header.Get("X-Signature-Version") == utils.SignVersion:
+		ok = s.verifySign(rw, req, key, timestamp)
+	case s.legacyAuth:
+		ok = s.verifyLegacySign(rw, req, key, timestamp)
+	default:
+		ok = false
+		sendJSONResponse(rw, http.StatusBadRequest, "err", "Invalid X-Signature-Version")
+	}
+	if !ok {
+		return
+	}
+	next(rw, withAPIKey(req, key))
+}
+
+// scope check the api key which authed the request has the scope,
+// is allowed to use the request sender, and not exceeded the rate limit of the scope.
+// the request without an api key is allowed, the Auth middleware is not in use.
+func (s SPusher) scope(scope string, handle http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		key, ok := requestKey(req)
+		if !ok {
+			handle(w, req)
+			return
+		}
+		// the api keys and the sender registry are shared by all the tenants
+		if !key.HasScope(scope) || (scope == ScopeAdmin && key.Tenant != "") {
+			sendJSONResponse(w, http.StatusForbidden, "err", "X-App-Key has not the scope "+scope+".")
+			return
+		}
+		if sender, ok := mux.Vars(req)["sender"]; ok && !key.AllowSender(sender) {
+			sendJSONResponse(w, http.StatusForbidden, "err", "X-App-Key is not allowed to use the sender "+sender+".")
+			return
+		}
+		if wait, ok := s.limiter.allow(key, scope); !ok {
+			sendRetryAfter(w, wait, "X-App-Key exceeded the rate limit of "+scope+".")
+			return
+		}
+		handle(w, req)
+	}
+}
+
+// verifySign verify the HmacSHA256 signature and the nonce
+func (s SPusher) verifySign(rw http.ResponseWriter, req *http.Request, key APIKey, timestamp string) bool {
+	var nonce = req.Header.Get("X-Request-Nonce")
+	if nonce == "" {
+		sendJSONResponse(rw, http.StatusBadRequest, "err", "Invalid X-Request-Nonce")
+		return false
+	}
+	body, err := readBody(req)
+	if err != nil {
+		sendJSONResponse(rw, http.StatusBadRequest, "err", "Invalid request body")
+		return false
+	}
+	var exceptSign = utils.HmacSHA256(key.Secret, req.Method, req.URL.Path, req.URL.Query(), body, timestamp, nonce)
+	var sign = req.Header.Get("X-Request-Signature")
+	if sign != exceptSign {
+		sendJSONResponse(rw, http.StatusBadRequest, "err", "Invalid X-Request-Signature")
+		return false
+	}
+	// only remember the nonce of a valid request
+	ok, wait := s.nonces.use(key.Key + ":" + nonce)
+	if ok {
+		return true
+	}
+	if wait > 0 {
+		sendRetryAfter(rw, wait, "Too many requests in the request window")
+		return false
+	}
+	sendJSONResponse(rw, http.StatusBadRequest, "err", "Replayed X-Request-Nonce")
+	return false
+}
+
+// verifyLegacySign verify the HmacMD5 signature
+func (s SPusher) verifyLegacySign(rw http.ResponseWriter, req *http.Request, key APIKey, timestamp string) bool {
 	var signParams = make(map[string]string)
-	signParams["app_key"] = appKey
+	signParams["app_key"] = key.Key
 	signParams["timestamp"] = timestamp
 	signParams["path"] = req.URL.Path
 	var query = req.URL.Query()
@@ -36,7 +117,15 @@ func (s SPusher) Auth(rw http.ResponseWriter, req *http.Request, next http.Handl
 			signParams[key] = query.Get(key)
 		}
 	}
-	if req.Method == "POST" {
+	if isJSONRequest(req) {
+		// sign the json body as it is
+		body, err := readBody(req)
+		if err != nil {
+			sendJSONResponse(rw, http.StatusBadRequest, "err", "Invalid request body")
+			return false
+		}
+		signParams["body"] = string(body)
+	} else if req.Method == "POST" {
 		req.ParseForm()
 		if req.Form != nil {
 			for key := range req.Form {
@@ -45,11 +134,11 @@ func (s SPusher) Auth(rw http.ResponseWriter, req *http.Request, next http.Handl
 
 		}
 	}
-	var exceptSign = utils.HmacMD5(s.secret, signParams)
+	var exceptSign = utils.HmacMD5(key.Secret, signParams)
 	var sign = req.Header.Get("X-Request-Signature")
 	if sign != exceptSign {
 		sendJSONResponse(rw, http.StatusBadRequest, "err", "Invalid X-Request-Signature")
-		return
+		return false
 	}
-	next(rw, req)
+	return true
 }
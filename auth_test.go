@@ -0,0 +1,90 @@
+package pusher
+
+import (
+	"github.com/Lupino/pusher/utils"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// signedRequest create a json request signed by the HmacSHA256 signature like the client
+func signedRequest(key, secret, body, nonce string, at time.Time) *http.Request {
+	req := httptest.NewRequest("POST", "/pusher/pushers/?force=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	var timestamp = strconv.FormatInt(at.Unix(), 10)
+	req.Header.Set("X-App-Key", key)
+	req.Header.Set("X-Request-Time", timestamp)
+	req.Header.Set("X-Request-Nonce", nonce)
+	req.Header.Set("X-Signature-Version", utils.SignVersion)
+	req.Header.Set("X-Request-Signature", utils.HmacSHA256(secret, req.Method, req.URL.Path, req.URL.Query(), []byte(body), timestamp, nonce))
+	return req
+}
+
+func TestAuthSign(t *testing.T) {
+	sp, _ := newTestSPusher(t)
+	sp.SetKey("key")
+	sp.SetSecret("secret")
+	var now = time.Now()
+	var body = `{"pusher": "4711"}`
+	var tests = []struct {
+		name string
+		req  func() *http.Request
+		code int
+	}{
+		{"valid", func() *http.Request {
+			return signedRequest("key", "secret", body, "nonce1", now)
+		}, http.StatusOK},
+		{"replayed nonce", func() *http.Request {
+			return signedRequest("key", "secret", body, "nonce1", now)
+		}, http.StatusBadRequest},
+		{"unknown key", func() *http.Request {
+			return signedRequest("other", "secret", body, "nonce2", now)
+		}, http.StatusBadRequest},
+		{"wrong secret", func() *http.Request {
+			return signedRequest("key", "other", body, "nonce3", now)
+		}, http.StatusBadRequest},
+		{"stale time", func() *http.Request {
+			return signedRequest("key", "secret", body, "nonce4", now.Add(-requestWindow-time.Minute))
+		}, http.StatusBadRequest},
+		{"tampered body", func() *http.Request {
+			req := signedRequest("key", "secret", body, "nonce5", now)
+			req.Body = httptest.NewRequest("POST", "/", strings.NewReader(`{"pusher": "4712"}`)).Body
+			return req
+		}, http.StatusBadRequest},
+		{"tampered query", func() *http.Request {
+			req := signedRequest("key", "secret", body, "nonce6", now)
+			req.URL.RawQuery = "force=false"
+			return req
+		}, http.StatusBadRequest},
+		{"no nonce", func() *http.Request {
+			req := signedRequest("key", "secret", body, "", now)
+			return req
+		}, http.StatusBadRequest},
+		{"legacy", func() *http.Request {
+			req := signedRequest("key", "secret", body, "nonce7", now)
+			req.Header.Del("X-Signature-Version")
+			return req
+		}, http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		var called bool
+		rec := httptest.NewRecorder()
+		sp.Auth(rec, test.req(), func(w http.ResponseWriter, req *http.Request) {
+			called = true
+			// the handler can read the signed body again
+			if params, err := readParams(req); err != nil || params.Get("pusher") != "4711" {
+				t.Errorf("%s: the body should be read again, got %v", test.name, err)
+			}
+			if key, ok := requestKey(req); !ok || key.Key != "key" {
+				t.Errorf("%s: the request should be authed by the key", test.name)
+			}
+			w.WriteHeader(http.StatusOK)
+		})
+		if rec.Code != test.code || called != (test.code == http.StatusOK) {
+			t.Errorf("%s: status %d called %v, want %d: %s", test.name, rec.Code, called, test.code, rec.Body)
+		}
+	}
+}
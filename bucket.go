@@ -0,0 +1,64 @@
+package pusher
+
+import (
+	"sort"
+	"sync"
+)
+
+// memoryBucket a Bucket in memory, used when the Storer is not a BucketStorer
+type memoryBucket struct {
+	locker sync.RWMutex
+	data   map[string][]byte
+}
+
+func newMemoryBucket() *memoryBucket {
+	return &memoryBucket{data: make(map[string][]byte)}
+}
+
+func (b *memoryBucket) Put(key string, value []byte) error {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	b.data[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (b *memoryBucket) Get(key string) ([]byte, error) {
+	b.locker.RLock()
+	defer b.locker.RUnlock()
+	return b.data[key], nil
+}
+
+func (b *memoryBucket) Delete(key string) error {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	delete(b.data, key)
+	return nil
+}
+
+func (b *memoryBucket) ForEach(fn func(key string, value []byte) error) error {
+	b.locker.RLock()
+	var keys = make([]string, 0, len(b.data))
+	for key := range b.data {
+		keys = append(keys, key)
+	}
+	b.locker.RUnlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, _ := b.Get(key)
+		if value == nil {
+			continue
+		}
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openBucket open a named bucket from the storer, or a memory bucket
+func openBucket(storer Storer, name string) (Bucket, error) {
+	if bs, ok := storer.(BucketStorer); ok {
+		return bs.Bucket(name)
+	}
+	return newMemoryBucket(), nil
+}
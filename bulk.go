@@ -0,0 +1,232 @@
+package pusher
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/blevesearch/bleve"
+	"sort"
+	"sync"
+	"time"
+)
+
+// bulk operations
+const (
+	BulkAddTag       = "addTag"
+	BulkRemoveTag    = "removeTag"
+	BulkAddSender    = "addSender"
+	BulkRemoveSender = "removeSender"
+	BulkRenameTag    = "renameTag"
+)
+
+// bulk job status
+const (
+	BulkRunning = "running"
+	BulkDone    = "done"
+	BulkFailed  = "failed"
+)
+
+const (
+	bulkBatchSize = 100
+	bulkMaxJobs   = 100
+)
+
+// BulkJob a background job to add or remove a tag or sender for many pushers
+type BulkJob struct {
+	ID         string `json:"id"`
+	Op         string `json:"op"`
+	Value      string `json:"value"`
+	To         string `json:"to,omitempty"`
+	Query      string `json:"q,omitempty"`
+	Status     string `json:"status"`
+	Total      int    `json:"total"`
+	Processed  int    `json:"processed"`
+	Changed    int    `json:"changed"`
+	Failed     int    `json:"failed"`
+	Err        string `json:"err,omitempty"`
+	CreatedAt  int64  `json:"createdAt"`
+	FinishedAt int64  `json:"finishedAt,omitempty"`
+}
+
+type bulkJobs struct {
+	locker sync.RWMutex
+	jobs   map[string]*BulkJob
+}
+
+func newBulkJobs() *bulkJobs {
+	return &bulkJobs{jobs: make(map[string]*BulkJob)}
+}
+
+func (b *bulkJobs) add(job BulkJob) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	b.jobs[job.ID] = &job
+	if len(b.jobs) > bulkMaxJobs {
+		b.evict()
+	}
+}
+
+// evict the oldest finished job
+func (b *bulkJobs) evict() {
+	var oldest *BulkJob
+	for _, job := range b.jobs {
+		if job.Status == BulkRunning {
+			continue
+		}
+		if oldest == nil || job.CreatedAt < oldest.CreatedAt {
+			oldest = job
+		}
+	}
+	if oldest != nil {
+		delete(b.jobs, oldest.ID)
+	}
+}
+
+func (b *bulkJobs) update(id string, fn func(*BulkJob)) {
+	b.locker.Lock()
+	defer b.locker.Unlock()
+	if job, ok := b.jobs[id]; ok {
+		fn(job)
+	}
+}
+
+func (b *bulkJobs) get(id string) (job BulkJob, ok bool) {
+	b.locker.RLock()
+	defer b.locker.RUnlock()
+	var p *BulkJob
+	if p, ok = b.jobs[id]; ok {
+		job = *p
+	}
+	return
+}
+
+func (b *bulkJobs) all() []BulkJob {
+	b.locker.RLock()
+	defer b.locker.RUnlock()
+	var jobs = make([]BulkJob, 0, len(b.jobs))
+	for _, job := range b.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt > jobs[j].CreatedAt
+	})
+	return jobs
+}
+
+func newBulkID() string {
+	var buf = make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+func applyBulk(p *Pusher, job BulkJob) bool {
+	switch job.Op {
+	case BulkAddTag:
+		return p.AddTag(job.Value)
+	case BulkRemoveTag:
+		return p.DelTag(job.Value)
+	case BulkAddSender:
+		return p.AddSender(job.Value)
+	case BulkRemoveSender:
+		return p.DelSender(job.Value)
+	case BulkRenameTag:
+		// rename to an exists tag is merge them
+		removed := p.DelTag(job.Value)
+		added := p.AddTag(job.To)
+		return removed || added
+	}
+	return false
+}
+
+// startBulk create a bulk job and run it on background,
+// the pushers is the explicit pusher ID list, otherwise use the bleve query job.Query.
+func (s SPusher) startBulk(job BulkJob, pushers []string) BulkJob {
+	job.ID = newBulkID()
+	job.Status = BulkRunning
+	job.Total = len(pushers)
+	job.CreatedAt = time.Now().Unix()
+	s.bulk.add(job)
+	go s.runBulk(job, pushers)
+	return job
+}
+
+func (s SPusher) runBulk(job BulkJob, pushers []string) {
+	var (
+		err error
+		id  = job.ID
+		q   = job.Query
+	)
+	if len(pushers) == 0 && q != "" {
+		if pushers, err = s.searchIDs(q); err != nil {
+			s.logger.Error("searchIDs() failed", "bulk", job.ID, "err", err)
+			s.bulk.update(id, func(j *BulkJob) {
+				j.Status = BulkFailed
+				j.Err = err.Error()
+				j.FinishedAt = time.Now().Unix()
+			})
+			return
+		}
+		s.bulk.update(id, func(j *BulkJob) {
+			j.Total = len(pushers)
+		})
+	}
+
+	for start := 0; start < len(pushers); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(pushers) {
+			end = len(pushers)
+		}
+		var (
+			changed []Pusher
+			failed  int
+		)
+		for _, pusher := range pushers[start:end] {
+			p, _ := s.storer.Get(pusher)
+			if p.ID == "" {
+				failed++
+				continue
+			}
+			if applyBulk(&p, job) {
+				changed = append(changed, p)
+			}
+		}
+		if err = s.savePushers(changed); err != nil {
+			s.logger.Error("savePushers() failed", "bulk", job.ID, "err", err)
+			failed += len(changed)
+			changed = nil
+		}
+		s.bulk.update(id, func(j *BulkJob) {
+			j.Processed += end - start
+			j.Changed += len(changed)
+			j.Failed += failed
+			if err != nil {
+				j.Err = err.Error()
+			}
+		})
+	}
+
+	s.bulk.update(id, func(j *BulkJob) {
+		j.Status = BulkDone
+		j.FinishedAt = time.Now().Unix()
+	})
+}
+
+// searchIDs collect all the pusher ID match the query
+func (s SPusher) searchIDs(q string) (ids []string, err error) {
+	var (
+		size         = 1000
+		searchResult *bleve.SearchResult
+	)
+	for from := 0; ; from += size {
+		searchRequest := bleve.NewSearchRequestOptions(parseQuery(q), size, from, false)
+		if searchResult, err = s.index.Search(searchRequest); err != nil {
+			return nil, err
+		}
+		for _, hit := range searchResult.Hits {
+			ids = append(ids, hit.ID)
+		}
+		if len(searchResult.Hits) < size || uint64(from+size) >= searchResult.Total {
+			break
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,135 @@
+package pusher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestApplyBulk(t *testing.T) {
+	var tests = []struct {
+		name    string
+		job     BulkJob
+		changed bool
+		tags    []string
+		senders []string
+	}{
+		{"add tag", BulkJob{Op: BulkAddTag, Value: "new"}, true, []string{"vip", "old", "new"}, []string{"sendmail"}},
+		{"add exists tag", BulkJob{Op: BulkAddTag, Value: "vip"}, false, []string{"vip", "old"}, []string{"sendmail"}},
+		{"remove tag", BulkJob{Op: BulkRemoveTag, Value: "old"}, true, []string{"vip"}, []string{"sendmail"}},
+		{"remove missing tag", BulkJob{Op: BulkRemoveTag, Value: "new"}, false, []string{"vip", "old"}, []string{"sendmail"}},
+		{"add sender", BulkJob{Op: BulkAddSender, Value: "sendsms"}, true, []string{"vip", "old"}, []string{"sendmail", "sendsms"}},
+		{"remove sender", BulkJob{Op: BulkRemoveSender, Value: "sendmail"}, true, []string{"vip", "old"}, []string{}},
+		{"rename tag", BulkJob{Op: BulkRenameTag, Value: "old", To: "new"}, true, []string{"vip", "new"}, []string{"sendmail"}},
+		{"rename to exists tag", BulkJob{Op: BulkRenameTag, Value: "old", To: "vip"}, true, []string{"vip"}, []string{"sendmail"}},
+		{"rename missing tag", BulkJob{Op: BulkRenameTag, Value: "new", To: "vip"}, false, []string{"vip", "old"}, []string{"sendmail"}},
+		{"unknown op", BulkJob{Op: "drop", Value: "vip"}, false, []string{"vip", "old"}, []string{"sendmail"}},
+	}
+	for _, test := range tests {
+		var p = Pusher{ID: "4711", Tags: []string{"vip", "old"}, Senders: []string{"sendmail"}}
+		if got := applyBulk(&p, test.job); got != test.changed {
+			t.Errorf("%s: changed %v, want %v", test.name, got, test.changed)
+		}
+		if len(p.Tags) != len(test.tags) || (len(p.Tags) > 0 && !reflect.DeepEqual(p.Tags, test.tags)) {
+			t.Errorf("%s: tags %v, want %v", test.name, p.Tags, test.tags)
+		}
+		if len(p.Senders) != len(test.senders) || (len(p.Senders) > 0 && !reflect.DeepEqual(p.Senders, test.senders)) {
+			t.Errorf("%s: senders %v, want %v", test.name, p.Senders, test.senders)
+		}
+	}
+}
+
+func TestRunBulk(t *testing.T) {
+	sp, _ := newTestSPusher(t)
+	var pushers []string
+	for i := 0; i < bulkBatchSize+10; i++ {
+		id := strconv.Itoa(4700 + i)
+		pushers = append(pushers, id)
+		sp.storer.Set(Pusher{ID: id, Tags: []string{"vip"}})
+	}
+	// a missing pusher fails, a pusher has the tag is not changed
+	pushers = append(pushers, "missing")
+	sp.storer.Set(Pusher{ID: "4699", Tags: []string{"vip", "new"}})
+	pushers = append(pushers, "4699")
+
+	var job = BulkJob{ID: newBulkID(), Op: BulkAddTag, Value: "new", Status: BulkRunning, Total: len(pushers)}
+	sp.bulk.add(job)
+	sp.runBulk(job, pushers)
+
+	got, ok := sp.bulk.get(job.ID)
+	if !ok {
+		t.Fatal("the bulk job should be kept")
+	}
+	if got.Status != BulkDone || got.FinishedAt == 0 {
+		t.Errorf("the bulk job should be done, got %+v", got)
+	}
+	if got.Processed != len(pushers) || got.Changed != bulkBatchSize+10 || got.Failed != 1 {
+		t.Errorf("the bulk job counts %+v, want processed %d changed %d failed 1", got, len(pushers), bulkBatchSize+10)
+	}
+	if p, _ := sp.storer.Get("4700"); !reflect.DeepEqual(p.Tags, []string{"vip", "new"}) {
+		t.Errorf("the pusher tags %v should be saved", p.Tags)
+	}
+}
+
+func TestBulkJobsEvict(t *testing.T) {
+	var jobs = newBulkJobs()
+	jobs.add(BulkJob{ID: "running", Status: BulkRunning, CreatedAt: 1})
+	jobs.add(BulkJob{ID: "oldest", Status: BulkDone, CreatedAt: 2})
+	for i := 0; i < bulkMaxJobs-1; i++ {
+		jobs.add(BulkJob{ID: strconv.Itoa(i), Status: BulkDone, CreatedAt: int64(10 + i)})
+	}
+	if all := jobs.all(); len(all) != bulkMaxJobs {
+		t.Fatalf("keep %d jobs, want %d", len(all), bulkMaxJobs)
+	}
+	if _, ok := jobs.get("running"); !ok {
+		t.Error("the running job should not be evicted")
+	}
+	if _, ok := jobs.get("oldest"); ok {
+		t.Error("the oldest finished job should be evicted")
+	}
+	if all := jobs.all(); all[0].CreatedAt < all[len(all)-1].CreatedAt {
+		t.Error("the jobs should be sorted by the newest first")
+	}
+}
+
+func TestHandleBulk(t *testing.T) {
+	sp, _ := newTestSPusher(t)
+	sp.senders.announce(SenderInfo{Name: "sendmail"}, "worker")
+	var tests = []struct {
+		name  string
+		op    string
+		value string
+		form  url.Values
+		key   *APIKey
+		code  int
+	}{
+		{"pushers", BulkAddTag, "vip", url.Values{"pusher": {"4711", "4712"}}, nil, http.StatusOK},
+		{"query", BulkRemoveTag, "vip", url.Values{"q": {"tags:vip"}}, nil, http.StatusOK},
+		{"no pusher or query", BulkAddTag, "vip", url.Values{}, nil, http.StatusNotAcceptable},
+		{"invalid pusher", BulkAddTag, "vip", url.Values{"pusher": {"4711", "acme/4712"}}, nil, http.StatusNotAcceptable},
+		{"registered sender", BulkAddSender, "sendmail", url.Values{"pusher": {"4711"}}, nil, http.StatusOK},
+		{"unknown sender", BulkAddSender, "sendsms", url.Values{"pusher": {"4711"}}, nil, http.StatusNotAcceptable},
+		{"force sender", BulkAddSender, "sendsms", url.Values{"pusher": {"4711"}, "force": {"true"}}, nil, http.StatusOK},
+		{"sender not allowed", BulkRemoveSender, "sendsms", url.Values{"pusher": {"4711"}}, &APIKey{Key: "key", Senders: []string{"sendmail"}}, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		sp.handleBulk(rec, postForm("/pusher/bulk/", test.form, test.key), test.op, test.value)
+		if rec.Code != test.code {
+			t.Errorf("%s: status %d, want %d: %s", test.name, rec.Code, test.code, rec.Body)
+		}
+	}
+	var ops = make(map[string]bool)
+	for _, job := range sp.bulk.all() {
+		ops[job.Op] = true
+		if job.ID == "" || job.CreatedAt == 0 {
+			t.Errorf("the bulk job %+v should have the id and the created time", job)
+		}
+	}
+	if len(ops) != 3 {
+		t.Errorf("the started bulk ops %v, want %s, %s and %s", ops, BulkAddTag, BulkRemoveTag, BulkAddSender)
+	}
+}
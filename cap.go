@@ -0,0 +1,149 @@
+package pusher
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cap a frequency cap, at most Max pushes to a pusher in Per seconds
+type Cap struct {
+	Max int   `json:"max"`
+	Per int64 `json:"per"`
+}
+
+// String encode the cap as max/per, eg: 3/3600
+func (c Cap) String() string {
+	return strconv.Itoa(c.Max) + "/" + strconv.FormatInt(c.Per, 10)
+}
+
+// ParseCap parse a cap from max/per, eg: 3/3600 is at most 3 pushes an hour
+func ParseCap(s string) (c Cap, err error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		err = fmt.Errorf("invalid cap %s", s)
+		return
+	}
+	if c.Max, err = strconv.Atoi(parts[0]); err != nil {
+		return
+	}
+	if c.Per, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return
+	}
+	if c.Max < 0 || c.Per <= 0 {
+		err = fmt.Errorf("invalid cap %s", s)
+	}
+	return
+}
+
+// CapResult the result of take the caps of a pusher
+type CapResult struct {
+	Allowed bool `json:"allowed"`
+	// Cap the exceeded cap
+	Cap string `json:"cap,omitempty"`
+	// RetryAfter the seconds until the exceeded cap window end
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+type capWindow struct {
+	Start int64 `json:"start"`
+	Count int   `json:"count"`
+	Per   int64 `json:"per"`
+}
+
+// capCounters count the pushes of the pushers in the cap windows, persisted in the bucket,
+// the expired windows are swept every ten minutes
+type capCounters struct {
+	locker    sync.Mutex
+	windows   map[string]*capWindow
+	lastSweep int64
+	bucket    Bucket
+}
+
+func newCapCounters(bucket Bucket) (*capCounters, error) {
+	var cc = &capCounters{windows: make(map[string]*capWindow), bucket: bucket}
+	err := bucket.ForEach(func(key string, value []byte) error {
+		var w capWindow
+		if err := json.Unmarshal(value, &w); err != nil {
+			return err
+		}
+		cc.windows[key] = &w
+		return nil
+	})
+	return cc, err
+}
+
+func (cc *capCounters) save(name string, w *capWindow) error {
+	data, _ := json.Marshal(w)
+	return cc.bucket.Put(name, data)
+}
+
+func capName(pusher, sender string, c Cap) string {
+	return pusher + ":" + sender + ":" + c.String()
+}
+
+// take count a push if all the caps are not exceeded
+func (cc *capCounters) take(pusher, sender string, caps []Cap) (CapResult, error) {
+	cc.locker.Lock()
+	defer cc.locker.Unlock()
+	var now = time.Now().Unix()
+	if now-cc.lastSweep > 600 {
+		cc.sweep(now)
+	}
+	var windows = make([]*capWindow, len(caps))
+	for i, c := range caps {
+		var name = capName(pusher, sender, c)
+		w, ok := cc.windows[name]
+		if !ok || now >= w.Start+w.Per {
+			w = &capWindow{Start: now, Per: c.Per}
+			cc.windows[name] = w
+		}
+		if w.Count >= c.Max {
+			return CapResult{Cap: c.String(), RetryAfter: w.Start + w.Per - now}, nil
+		}
+		windows[i] = w
+	}
+	for i, w := range windows {
+		w.Count++
+		if err := cc.save(capName(pusher, sender, caps[i]), w); err != nil {
+			return CapResult{}, err
+		}
+	}
+	return CapResult{Allowed: true}, nil
+}
+
+// refund a push counted by take in the current windows, eg: the push is not delivered
+func (cc *capCounters) refund(pusher, sender string, caps []Cap) error {
+	cc.locker.Lock()
+	defer cc.locker.Unlock()
+	var now = time.Now().Unix()
+	for _, c := range caps {
+		var name = capName(pusher, sender, c)
+		w, ok := cc.windows[name]
+		if !ok || now >= w.Start+w.Per || w.Count == 0 {
+			continue
+		}
+		w.Count--
+		if err := cc.save(name, w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cc *capCounters) sweep(now int64) {
+	for name, w := range cc.windows {
+		if now >= w.Start+w.Per {
+			if err := cc.bucket.Delete(name); err != nil {
+				slog.Error("Bucket.Delete() failed", "err", err)
+				continue
+			}
+			delete(cc.windows, name)
+		}
+	}
+	cc.lastSweep = now
+}
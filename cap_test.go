@@ -0,0 +1,100 @@
+package pusher
+
+import (
+	"testing"
+)
+
+func TestParseCap(t *testing.T) {
+	var tests = []struct {
+		s   string
+		cap Cap
+		ok  bool
+	}{
+		{"3/3600", Cap{Max: 3, Per: 3600}, true},
+		{"0/60", Cap{Max: 0, Per: 60}, true},
+		{"3", Cap{}, false},
+		{"3/0", Cap{}, false},
+		{"-1/60", Cap{}, false},
+		{"a/60", Cap{}, false},
+	}
+	for _, test := range tests {
+		c, err := ParseCap(test.s)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseCap(%q) err %v, want ok %v", test.s, err, test.ok)
+			continue
+		}
+		if test.ok && c != test.cap {
+			t.Errorf("ParseCap(%q) = %+v, want %+v", test.s, c, test.cap)
+		}
+		if test.ok && c.String() != test.s {
+			t.Errorf("Cap.String() = %s, want %s", c.String(), test.s)
+		}
+	}
+}
+
+func TestCapTakeRefund(t *testing.T) {
+	var hourly = []Cap{{Max: 2, Per: 3600}, {Max: 3, Per: 86400}}
+	var tests = []struct {
+		name    string
+		caps    []Cap
+		ops     []string
+		allowed bool
+		cap     string
+	}{
+		{"in the caps", hourly, []string{"take"}, true, ""},
+		{"over the hour", hourly, []string{"take", "take"}, false, "2/3600"},
+		{"refunded", hourly, []string{"take", "take", "refund"}, true, ""},
+		{"over the day", []Cap{{Max: 2, Per: 3600}, {Max: 1, Per: 86400}}, []string{"take"}, false, "1/86400"},
+		{"refund without take", hourly, []string{"refund", "refund", "take"}, true, ""},
+		{"zero cap", []Cap{{Max: 0, Per: 60}}, nil, false, "0/60"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, err := newCapCounters(newMemoryBucket())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, op := range test.ops {
+				if op == "take" {
+					_, err = cc.take("4711", "sendsms", test.caps)
+				} else {
+					err = cc.refund("4711", "sendsms", test.caps)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			ret, err := cc.take("4711", "sendsms", test.caps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ret.Allowed != test.allowed || ret.Cap != test.cap {
+				t.Errorf("take %+v, want allowed %v cap %s", ret, test.allowed, test.cap)
+			}
+			if !ret.Allowed && ret.RetryAfter <= 0 {
+				t.Errorf("the exceeded cap should retry after the window end, got %d", ret.RetryAfter)
+			}
+		})
+	}
+}
+
+// the caps are counted per pusher and sender, and kept by the bucket
+func TestCapCountersPersist(t *testing.T) {
+	var bucket = newMemoryBucket()
+	var caps = []Cap{{Max: 1, Per: 3600}}
+	cc, _ := newCapCounters(bucket)
+	cc.take("4711", "sendsms", caps)
+	if ret, _ := cc.take("4712", "sendsms", caps); !ret.Allowed {
+		t.Fatal("the other pusher should be allowed")
+	}
+	if ret, _ := cc.take("4711", "sendmail", caps); !ret.Allowed {
+		t.Fatal("the other sender should be allowed")
+	}
+	cc, err := newCapCounters(bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret, _ := cc.take("4711", "sendsms", caps); ret.Allowed {
+		t.Fatal("the counters should be kept over the restart")
+	}
+}
@@ -0,0 +1,63 @@
+package pusher
+
+import (
+	"github.com/Lupino/pusher/utils"
+	"sync"
+)
+
+// changeLogSize the pusher changes kept in memory
+const changeLogSize = 10000
+
+// PusherChanges the pushers changed since a seq, for the pusher cache of the workers
+type PusherChanges struct {
+	// Epoch the id of the change log, a new one when the server restart
+	Epoch string `json:"epoch"`
+	// Seq the seq of the last change
+	Seq uint64 `json:"seq"`
+	// Reset the changes since the seq are lost, drop all the cached pushers
+	Reset bool `json:"reset"`
+	// Pushers the changed pushers qualified by the tenant
+	Pushers []string `json:"pushers"`
+}
+
+// changeLog record the changed pushers of every tenant in a ring
+type changeLog struct {
+	locker  sync.Mutex
+	epoch   string
+	seq     uint64
+	pushers []string
+}
+
+func newChangeLog() *changeLog {
+	return &changeLog{
+		epoch:   utils.Nonce(),
+		pushers: make([]string, changeLogSize),
+	}
+}
+
+func (cl *changeLog) add(pusher string) {
+	cl.locker.Lock()
+	defer cl.locker.Unlock()
+	cl.pushers[cl.seq%changeLogSize] = pusher
+	cl.seq++
+}
+
+// since return the pushers changed after the seq of the epoch
+func (cl *changeLog) since(epoch string, seq uint64) PusherChanges {
+	cl.locker.Lock()
+	defer cl.locker.Unlock()
+	var changes = PusherChanges{Epoch: cl.epoch, Seq: cl.seq, Pushers: make([]string, 0)}
+	if epoch != cl.epoch || seq > cl.seq || cl.seq-seq > changeLogSize {
+		changes.Reset = true
+		return changes
+	}
+	var seen = make(map[string]bool)
+	for ; seq < cl.seq; seq++ {
+		pusher := cl.pushers[seq%changeLogSize]
+		if !seen[pusher] {
+			seen[pusher] = true
+			changes.Pushers = append(changes.Pushers, pusher)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,46 @@
+package pusher
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChangeLogSince(t *testing.T) {
+	var cl = newChangeLog()
+	changes := cl.since("", 0)
+	if !changes.Reset {
+		t.Fatal("the unknown epoch should reset")
+	}
+	var epoch, seq = changes.Epoch, changes.Seq
+
+	cl.add("a")
+	cl.add("acme/b")
+	cl.add("a")
+	changes = cl.since(epoch, seq)
+	if changes.Reset || changes.Seq != 3 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if want := []string{"a", "acme/b"}; !reflect.DeepEqual(changes.Pushers, want) {
+		t.Fatalf("pushers %v, want %v", changes.Pushers, want)
+	}
+	if changes = cl.since(epoch, changes.Seq); changes.Reset || len(changes.Pushers) != 0 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+}
+
+func TestChangeLogLost(t *testing.T) {
+	var cl = newChangeLog()
+	var epoch = cl.epoch
+	for i := 0; i < changeLogSize+1; i++ {
+		cl.add("a")
+	}
+	if changes := cl.since(epoch, 0); !changes.Reset {
+		t.Fatal("the changes out of the log should reset")
+	}
+	if changes := cl.since(epoch, 1); changes.Reset || len(changes.Pushers) != 1 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if changes := cl.since(epoch, changeLogSize+2); !changes.Reset {
+		t.Fatal("the seq after the last change should reset")
+	}
+}
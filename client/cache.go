@@ -0,0 +1,203 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Cache a pusher cache of the client, the key is the pusher id qualified by the tenant
+type Cache interface {
+	Get(key string) (pusherLib.Pusher, bool)
+	Set(key string, pusher pusherLib.Pusher)
+	Delete(key string)
+	// Purge delete all the cached pushers
+	Purge()
+}
+
+type lruEntry struct {
+	key       string
+	pusher    pusherLib.Pusher
+	expiresAt time.Time
+}
+
+// lruCache a least recently used cache, the entry expires after the ttl
+type lruCache struct {
+	locker  sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+// NewLRUCache create a cache of the size, the pusher expires after the ttl
+func NewLRUCache(size int, ttl time.Duration) Cache {
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+func (c *lruCache) Get(key string) (pusherLib.Pusher, bool) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return pusherLib.Pusher{}, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return pusherLib.Pusher{}, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.pusher, true
+}
+
+func (c *lruCache) Set(key string, pusher pusherLib.Pusher) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	var expiresAt = time.Now().Add(c.ttl)
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.pusher = pusher
+		entry.expiresAt = expiresAt
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, pusher: pusher, expiresAt: expiresAt})
+	for c.size > 0 && c.order.Len() > c.size {
+		elem := c.order.Back()
+		c.order.Remove(elem)
+		delete(c.entries, elem.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) Delete(key string) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+func (c *lruCache) Purge() {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	c.entries = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+// SetCache cache the pushers got by GetPusher, the pusher changed by the client is invalidated,
+// run SyncCache to invalidate the pushers changed by the others
+func (client *PusherClient) SetCache(cache Cache) {
+	client.cache = cache
+}
+
+func (client PusherClient) cacheKey(pusher string) string {
+	return utils.JoinTenant(client.tenant, pusher)
+}
+
+// invalidate the cached pusher
+func (client PusherClient) invalidate(pusher string) {
+	if client.cache != nil {
+		client.cache.Delete(client.cacheKey(pusher))
+	}
+}
+
+// MergeSnapshot return the newer one of the pusher snapshot and the cached pusher by UpdatedAt,
+// cache the snapshot if it is newer
+func (client PusherClient) MergeSnapshot(snapshot pusherLib.Pusher) pusherLib.Pusher {
+	if client.cache == nil {
+		return snapshot
+	}
+	var key = client.cacheKey(snapshot.ID)
+	if cached, ok := client.cache.Get(key); ok && cached.UpdatedAt > snapshot.UpdatedAt {
+		return cached
+	}
+	client.cache.Set(key, snapshot)
+	return snapshot
+}
+
+type getChangesResult struct {
+	Changes pusherLib.PusherChanges `json:"changes"`
+}
+
+// GetChanges get the pushers of every tenant changed since the seq of the epoch, need an admin key
+func (client PusherClient) GetChanges(epoch string, seq uint64) (changes pusherLib.PusherChanges, err error) {
+	var rsp *http.Response
+	var path = "/pusher/changes/"
+	var query = url.Values{}
+	query.Add("epoch", epoch)
+	query.Add("seq", strconv.FormatUint(seq, 10))
+
+	var url = fmt.Sprintf("http://%s%s?%s", client.host, path, query.Encode())
+
+	var req, _ = http.NewRequest("GET", url, nil)
+	if len(client.key) > 0 {
+		client.signParams(req, path, query)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("get changes failed")
+		return
+	}
+	var ret getChangesResult
+	if err = json.NewDecoder(rsp.Body).Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret.Changes, nil
+}
+
+// SyncCache poll the pusher changes every interval until the ctx is done,
+// invalidate the changed pushers, all the cached pushers are dropped when
+// the changes are lost or failed to get
+func (client PusherClient) SyncCache(ctx context.Context, interval time.Duration) {
+	if client.cache == nil {
+		return
+	}
+	var (
+		epoch  string
+		seq    uint64
+		ticker = time.NewTicker(interval)
+	)
+	defer ticker.Stop()
+	for {
+		changes, err := client.WithContext(ctx).GetChanges(epoch, seq)
+		switch {
+		case err != nil:
+			client.cache.Purge()
+			epoch = ""
+		case changes.Reset:
+			client.cache.Purge()
+			epoch, seq = changes.Epoch, changes.Seq
+		default:
+			for _, key := range changes.Pushers {
+				client.cache.Delete(key)
+			}
+			epoch, seq = changes.Epoch, changes.Seq
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package client
+
+import (
+	pusherLib "github.com/Lupino/pusher"
+	"testing"
+	"time"
+)
+
+func TestLRUCacheEvict(t *testing.T) {
+	var c = NewLRUCache(2, time.Minute)
+	c.Set("a", pusherLib.Pusher{ID: "a"})
+	c.Set("b", pusherLib.Pusher{ID: "b"})
+	// a is used recently, b is evicted
+	c.Get("a")
+	c.Set("c", pusherLib.Pusher{ID: "c"})
+	if _, ok := c.Get("b"); ok {
+		t.Fatal("the least recently used pusher should be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if p, ok := c.Get(key); !ok || p.ID != key {
+			t.Fatalf("the pusher %s should be cached", key)
+		}
+	}
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("the deleted pusher should not be cached")
+	}
+	c.Purge()
+	if _, ok := c.Get("c"); ok {
+		t.Fatal("the purged pusher should not be cached")
+	}
+}
+
+func TestLRUCacheExpire(t *testing.T) {
+	var c = NewLRUCache(2, time.Millisecond)
+	c.Set("a", pusherLib.Pusher{ID: "a"})
+	time.Sleep(2 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("the expired pusher should not be cached")
+	}
+}
+
+func TestMergeSnapshot(t *testing.T) {
+	var client = New("localhost:6000", "", "")
+	client.SetCache(NewLRUCache(10, time.Minute))
+	client.MergeSnapshot(pusherLib.Pusher{ID: "a", Email: "new", UpdatedAt: 2})
+	if p := client.MergeSnapshot(pusherLib.Pusher{ID: "a", Email: "old", UpdatedAt: 1}); p.Email != "new" {
+		t.Fatalf("the newer cached pusher should be used, got %s", p.Email)
+	}
+	if p := client.MergeSnapshot(pusherLib.Pusher{ID: "a", Email: "newer", UpdatedAt: 3}); p.Email != "newer" {
+		t.Fatalf("the newer snapshot should be used, got %s", p.Email)
+	}
+}
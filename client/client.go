@@ -1,11 +1,14 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/tracing"
 	"github.com/Lupino/pusher/utils"
-	"log"
+	"io/ioutil"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -18,6 +21,11 @@ type PusherClient struct {
 	host   string
 	key    string
 	secret string
+	legacy bool
+	tenant string
+	ctx    context.Context
+	cache  Cache
+	logger *slog.Logger
 }
 
 // New create new pusher client
@@ -25,7 +33,88 @@ func New(host, key, secret string) PusherClient {
 	return PusherClient{host: host, key: key, secret: secret}
 }
 
+// SetLegacySign sign the request with the legacy HmacMD5 signature
+func (client *PusherClient) SetLegacySign(legacy bool) {
+	client.legacy = legacy
+}
+
+// SetLogger set the structured logger of the client, the default is slog.Default()
+func (client *PusherClient) SetLogger(logger *slog.Logger) {
+	client.logger = logger
+}
+
+func (client PusherClient) log() *slog.Logger {
+	if client.logger == nil {
+		return slog.Default()
+	}
+	return client.logger
+}
+
+// Tenant return a client which use the pushers of the tenant,
+// the api key must be an admin key without tenant
+func (client PusherClient) Tenant(tenant string) PusherClient {
+	client.tenant = tenant
+	return client
+}
+
+// WithContext return a client which send the requests with the context,
+// the requests are cancelled when the context is done
+func (client PusherClient) WithContext(ctx context.Context) PusherClient {
+	client.ctx = ctx
+	return client
+}
+
+func (client PusherClient) do(req *http.Request) (*http.Response, error) {
+	if len(client.tenant) > 0 {
+		req.Header.Set("X-Tenant", client.tenant)
+	}
+	if client.ctx != nil {
+		req = req.WithContext(client.ctx)
+		tracing.InjectHeader(client.ctx, req.Header)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// StatusError the pusher server reply an error status
+type StatusError struct {
+	StatusCode int
+	// RetryAfter the seconds of the Retry-After header, eg: a push over the quota
+	RetryAfter int
+	Err        string
+}
+
+func (e StatusError) Error() string {
+	return e.Err
+}
+
+func newStatusError(rsp *http.Response, err string) StatusError {
+	retryAfter, _ := strconv.Atoi(rsp.Header.Get("Retry-After"))
+	return StatusError{StatusCode: rsp.StatusCode, RetryAfter: retryAfter, Err: err}
+}
+
 func (client PusherClient) signParams(req *http.Request, path string, params url.Values) {
+	if client.legacy {
+		client.signLegacyParams(req, path, params)
+		return
+	}
+	var body []byte
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			body, _ = ioutil.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	var timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+	var nonce = utils.Nonce()
+	req.Header.Add("X-App-Key", client.key)
+	req.Header.Add("X-Request-Time", timestamp)
+	req.Header.Add("X-Request-Nonce", nonce)
+	req.Header.Add("X-Signature-Version", utils.SignVersion)
+	var sign = utils.HmacSHA256(client.secret, req.Method, path, req.URL.Query(), body, timestamp, nonce)
+	req.Header.Add("X-Request-Signature", sign)
+}
+
+func (client PusherClient) signLegacyParams(req *http.Request, path string, params url.Values) {
 	var signParams = make(map[string]string)
 	signParams["path"] = path
 	req.Header.Add("X-App-Key", client.key)
@@ -46,14 +135,20 @@ func (client PusherClient) signPath(req *http.Request, path string) {
 
 // GetPusher from client
 func (client PusherClient) GetPusher(pusher string) (p pusherLib.Pusher, err error) {
+	if client.cache != nil {
+		var ok bool
+		if p, ok = client.cache.Get(client.cacheKey(pusher)); ok {
+			return
+		}
+	}
 	var rsp *http.Response
 	var path = "/pusher/pushers/" + pusher + "/"
 	var req, _ = http.NewRequest("GET", "http://"+client.host+path, nil)
 	if len(client.key) > 0 {
 		client.signPath(req, path)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -64,7 +159,7 @@ func (client PusherClient) GetPusher(pusher string) (p pusherLib.Pusher, err err
 	var ret map[string]pusherLib.Pusher
 	decoder := json.NewDecoder(rsp.Body)
 	if err = decoder.Decode(&ret); err != nil {
-		log.Printf("json.NewDecoder().Decode() failed (%s)", err)
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
 		return
 	}
 	var ok bool
@@ -72,6 +167,9 @@ func (client PusherClient) GetPusher(pusher string) (p pusherLib.Pusher, err err
 		err = fmt.Errorf("pusher[%s] not exists", pusher)
 		return
 	}
+	if client.cache != nil {
+		client.cache.Set(client.cacheKey(pusher), p)
+	}
 	return
 }
 
@@ -96,8 +194,8 @@ func (client PusherClient) GetPusherList(from, size int) (total int, pushers []p
 	if len(client.key) > 0 {
 		client.signParams(req, path, query)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -108,7 +206,7 @@ func (client PusherClient) GetPusherList(from, size int) (total int, pushers []p
 	var ret getAllPusherResult
 	decoder := json.NewDecoder(rsp.Body)
 	if err = decoder.Decode(&ret); err != nil {
-		log.Printf("json.NewDecoder().Decode() failed (%s)", err)
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
 		return
 	}
 	return ret.Total, ret.Pushers, nil
@@ -137,8 +235,8 @@ func (client PusherClient) SearchPusher(q string, from, size int) (total int, pu
 	if len(client.key) > 0 {
 		client.signParams(req, path, query)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -149,7 +247,7 @@ func (client PusherClient) SearchPusher(q string, from, size int) (total int, pu
 	var ret searchPusherResult
 	decoder := json.NewDecoder(rsp.Body)
 	if err = decoder.Decode(&ret); err != nil {
-		log.Printf("json.NewDecoder().Decode() failed (%s)", err)
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
 		return
 	}
 	return ret.Total, ret.Pushers, nil
@@ -157,6 +255,9 @@ func (client PusherClient) SearchPusher(q string, from, size int) (total int, pu
 
 // AddPusher create a new pusher
 func (client PusherClient) AddPusher(pusher pusherLib.Pusher) (err error) {
+	if !pusherLib.ValidPusherID(pusher.ID) {
+		return fmt.Errorf("invalid pusher %s", pusher.ID)
+	}
 	var rsp *http.Response
 	var path = "/pusher/pushers/"
 	var form = url.Values{}
@@ -164,7 +265,13 @@ func (client PusherClient) AddPusher(pusher pusherLib.Pusher) (err error) {
 	form.Add("email", pusher.Email)
 	form.Add("nickname", pusher.NickName)
 	form.Add("phoneNumber", pusher.PhoneNumber)
-	form.Add("CreatedAt", strconv.FormatInt(pusher.CreatedAt, 10))
+	form.Add("createdAt", strconv.FormatInt(pusher.CreatedAt, 10))
+	for _, tag := range pusher.Tags {
+		form.Add("tags", tag)
+	}
+	for _, sender := range pusher.Senders {
+		form.Add("senders", sender)
+	}
 
 	var url = fmt.Sprintf("http://%s%s", client.host, path)
 
@@ -173,8 +280,8 @@ func (client PusherClient) AddPusher(pusher pusherLib.Pusher) (err error) {
 	if len(client.key) > 0 {
 		client.signParams(req, path, form)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -182,6 +289,7 @@ func (client PusherClient) AddPusher(pusher pusherLib.Pusher) (err error) {
 		err = fmt.Errorf("create pusher failed")
 		return
 	}
+	client.invalidate(pusher.ID)
 	return nil
 }
 
@@ -195,8 +303,8 @@ func (client PusherClient) RemovePusher(pusher string) (err error) {
 	if len(client.key) > 0 {
 		client.signPath(req, path)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -204,6 +312,7 @@ func (client PusherClient) RemovePusher(pusher string) (err error) {
 		err = fmt.Errorf("remove pusher (%s) failed", pusher)
 		return
 	}
+	client.invalidate(pusher)
 	return nil
 }
 
@@ -223,8 +332,8 @@ func (client PusherClient) UpdatePusher(pusher string, updated map[string]string
 	if len(client.key) > 0 {
 		client.signParams(req, path, form)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -232,6 +341,7 @@ func (client PusherClient) UpdatePusher(pusher string, updated map[string]string
 		err = fmt.Errorf("update pusher (%s) failed", pusher)
 		return
 	}
+	client.invalidate(pusher)
 	return nil
 }
 
@@ -245,8 +355,8 @@ func (client PusherClient) RemoveTag(pusher, tag string) (err error) {
 	if len(client.key) > 0 {
 		client.signPath(req, path)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -254,6 +364,7 @@ func (client PusherClient) RemoveTag(pusher, tag string) (err error) {
 		err = fmt.Errorf("remove pusher (%s) tag (%s) failed", pusher, tag)
 		return
 	}
+	client.invalidate(pusher)
 	return nil
 }
 
@@ -267,8 +378,8 @@ func (client PusherClient) AddTag(pusher, tag string) (err error) {
 	if len(client.key) > 0 {
 		client.signPath(req, path)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -276,6 +387,7 @@ func (client PusherClient) AddTag(pusher, tag string) (err error) {
 		err = fmt.Errorf("remove pusher (%s) tag (%s) failed", pusher, tag)
 		return
 	}
+	client.invalidate(pusher)
 	return nil
 }
 
@@ -294,8 +406,8 @@ func (client PusherClient) AddSender(pusher, sender string) (err error) {
 	if len(client.key) > 0 {
 		client.signParams(req, path, form)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -303,6 +415,7 @@ func (client PusherClient) AddSender(pusher, sender string) (err error) {
 		err = fmt.Errorf("remove pusher (%s) sender (%s) failed", pusher, sender)
 		return
 	}
+	client.invalidate(pusher)
 	return nil
 }
 
@@ -321,8 +434,8 @@ func (client PusherClient) RemoveSender(pusher, sender string) (err error) {
 	if len(client.key) > 0 {
 		client.signParams(req, path, form)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -330,6 +443,7 @@ func (client PusherClient) RemoveSender(pusher, sender string) (err error) {
 		err = fmt.Errorf("remove pusher (%s) sender (%s) failed", pusher, sender)
 		return
 	}
+	client.invalidate(pusher)
 	return nil
 }
 
@@ -340,11 +454,52 @@ type pushResult struct {
 
 // Push message to pusher server by client
 func (client PusherClient) Push(sender, pusher, data, schedat string) (name string, err error) {
+	return client.PushPriority(sender, pusher, data, schedat, "")
+}
+
+// PushOptions the options of push and pushall
+type PushOptions struct {
+	Priority string
+	// ExpiresAt the unix time the message is useless
+	ExpiresAt int64
+	// TTL the seconds the message is useful after the schedat
+	TTL int64
+	// Meta the metadata travel with the job to the sender
+	Meta map[string]string
+}
+
+func (opts PushOptions) encode(form url.Values) {
+	if len(opts.Priority) > 0 {
+		form.Set("priority", opts.Priority)
+	}
+	if opts.ExpiresAt > 0 {
+		form.Set("expiresAt", strconv.FormatInt(opts.ExpiresAt, 10))
+	}
+	if opts.TTL > 0 {
+		form.Set("ttl", strconv.FormatInt(opts.TTL, 10))
+	}
+	if len(opts.Meta) > 0 {
+		meta, _ := json.Marshal(opts.Meta)
+		form.Set("meta", string(meta))
+	}
+}
+
+// PushPriority push message to pusher with the priority
+func (client PusherClient) PushPriority(sender, pusher, data, schedat, priority string) (name string, err error) {
+	return client.PushWithOptions(sender, pusher, data, schedat, PushOptions{Priority: priority})
+}
+
+// PushWithOptions push message to pusher with the options
+func (client PusherClient) PushWithOptions(sender, pusher, data, schedat string, opts PushOptions) (name string, err error) {
+	if !pusherLib.ValidPusherID(pusher) {
+		return "", fmt.Errorf("invalid pusher %s", pusher)
+	}
 	var rsp *http.Response
 	var form = url.Values{}
 	form.Set("pusher", pusher)
 	form.Set("data", data)
 	form.Set("schedat", schedat)
+	opts.encode(form)
 
 	var path = fmt.Sprintf("/pusher/%s/push", sender)
 	var url = fmt.Sprintf("http://%s%s", client.host, path)
@@ -354,19 +509,19 @@ func (client PusherClient) Push(sender, pusher, data, schedat string) (name stri
 	if len(client.key) > 0 {
 		client.signParams(req, path, form)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
 	if int(rsp.StatusCode/100) != 2 {
-		err = fmt.Errorf("push sender[%s] pusher[%s] failed", sender, pusher)
+		err = newStatusError(rsp, fmt.Sprintf("push sender[%s] pusher[%s] failed", sender, pusher))
 		return
 	}
 	var ret pushResult
 	decoder := json.NewDecoder(rsp.Body)
 	if err = decoder.Decode(&ret); err != nil {
-		log.Printf("json.NewDecoder().Decode() failed (%s)", err)
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
 		return
 	}
 	return ret.Name, nil
@@ -374,9 +529,17 @@ func (client PusherClient) Push(sender, pusher, data, schedat string) (name stri
 
 // CancelPush cancel push by a push name
 func (client PusherClient) CancelPush(sender, name string) (err error) {
+	return client.CancelPushPriority(sender, name, "")
+}
+
+// CancelPushPriority cancel the push with the priority
+func (client PusherClient) CancelPushPriority(sender, name, priority string) (err error) {
 	var rsp *http.Response
 	var form = url.Values{}
 	form.Set("name", name)
+	if len(priority) > 0 {
+		form.Set("priority", priority)
+	}
 
 	var path = fmt.Sprintf("/pusher/%s/cancelpush", sender)
 	var url = fmt.Sprintf("http://%s%s", client.host, path)
@@ -386,8 +549,8 @@ func (client PusherClient) CancelPush(sender, name string) (err error) {
 	if len(client.key) > 0 {
 		client.signParams(req, path, form)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
@@ -400,11 +563,22 @@ func (client PusherClient) CancelPush(sender, name string) (err error) {
 
 // PushAll message to pusher server by client
 func (client PusherClient) PushAll(sender, data, tag, schedat string) (name string, err error) {
+	return client.PushAllPriority(sender, data, tag, schedat, "")
+}
+
+// PushAllPriority push message to all pusher with the priority
+func (client PusherClient) PushAllPriority(sender, data, tag, schedat, priority string) (name string, err error) {
+	return client.PushAllWithOptions(sender, data, tag, schedat, PushOptions{Priority: priority})
+}
+
+// PushAllWithOptions push message to all pusher with the options
+func (client PusherClient) PushAllWithOptions(sender, data, tag, schedat string, opts PushOptions) (name string, err error) {
 	var rsp *http.Response
 	var form = url.Values{}
 	form.Set("tag", tag)
 	form.Set("data", data)
 	form.Set("schedat", schedat)
+	opts.encode(form)
 
 	var path = fmt.Sprintf("/pusher/%s/pushall", sender)
 	var url = fmt.Sprintf("http://%s%s", client.host, path)
@@ -414,19 +588,597 @@ func (client PusherClient) PushAll(sender, data, tag, schedat string) (name stri
 	if len(client.key) > 0 {
 		client.signParams(req, path, form)
 	}
-	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("pushall sender(%s) tag (%s) failed", sender, tag)
+		return
+	}
+	var ret pushResult
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret.Name, nil
+}
+
+type bulkResult struct {
+	Job    pusherLib.BulkJob `json:"job"`
+	Result string            `json:"result"`
+}
+
+func (client PusherClient) bulk(path string, pushers []string, q string) (job pusherLib.BulkJob, err error) {
+	var rsp *http.Response
+	var form = url.Values{}
+	for _, pusher := range pushers {
+		if !pusherLib.ValidPusherID(pusher) {
+			return job, fmt.Errorf("invalid pusher %s", pusher)
+		}
+		form.Add("pusher", pusher)
+	}
+	if len(q) > 0 {
+		form.Set("q", q)
+	}
+
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if len(client.key) > 0 {
+		client.signParams(req, path, form)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("bulk (%s) failed", path)
+		return
+	}
+	var ret bulkResult
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret.Job, nil
+}
+
+// BulkAddTag add a tag to the pushers, or to all pushers match the query q
+func (client PusherClient) BulkAddTag(tag string, pushers []string, q string) (pusherLib.BulkJob, error) {
+	return client.bulk(fmt.Sprintf("/pusher/bulk/tags/%s/add", tag), pushers, q)
+}
+
+// BulkRemoveTag remove a tag from the pushers, or from all pushers match the query q
+func (client PusherClient) BulkRemoveTag(tag string, pushers []string, q string) (pusherLib.BulkJob, error) {
+	return client.bulk(fmt.Sprintf("/pusher/bulk/tags/%s/delete", tag), pushers, q)
+}
+
+// BulkAddSender add a sender to the pushers, or to all pushers match the query q
+func (client PusherClient) BulkAddSender(sender string, pushers []string, q string) (pusherLib.BulkJob, error) {
+	return client.bulk(fmt.Sprintf("/pusher/bulk/%s/add", sender), pushers, q)
+}
+
+// BulkRemoveSender remove a sender from the pushers, or from all pushers match the query q
+func (client PusherClient) BulkRemoveSender(sender string, pushers []string, q string) (pusherLib.BulkJob, error) {
+	return client.bulk(fmt.Sprintf("/pusher/bulk/%s/delete", sender), pushers, q)
+}
+
+// GetBulkJob get the bulk job progress
+func (client PusherClient) GetBulkJob(id string) (job pusherLib.BulkJob, err error) {
+	var rsp *http.Response
+	var path = fmt.Sprintf("/pusher/bulk/jobs/%s/", id)
+	var req, _ = http.NewRequest("GET", "http://"+client.host+path, nil)
+	if len(client.key) > 0 {
+		client.signPath(req, path)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("bulk job (%s) not exists", id)
+		return
+	}
+	var ret map[string]pusherLib.BulkJob
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret["job"], nil
+}
+
+type getTagsResult struct {
+	Tags  []pusherLib.TagCount `json:"tags"`
+	Other int                  `json:"other"`
+	Size  int                  `json:"size"`
+}
+
+// GetTags get the most used tags with the pusher count
+func (client PusherClient) GetTags(size int) (tags []pusherLib.TagCount, err error) {
+	var rsp *http.Response
+	var path = "/pusher/tags/"
+	var query = url.Values{}
+	query.Add("size", strconv.Itoa(size))
+
+	var url = fmt.Sprintf("http://%s%s?%s", client.host, path, query.Encode())
+
+	var req, _ = http.NewRequest("GET", url, nil)
+	if len(client.key) > 0 {
+		client.signParams(req, path, query)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("get tag list failed")
+		return
+	}
+	var ret getTagsResult
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret.Tags, nil
+}
+
+// GetTagPushers get the pusher list which has a tag
+func (client PusherClient) GetTagPushers(tag string, from, size int) (total int, pushers []pusherLib.Pusher, err error) {
+	var rsp *http.Response
+	var path = fmt.Sprintf("/pusher/tags/%s/pushers/", tag)
+	var query = url.Values{}
+	query.Add("from", strconv.Itoa(from))
+	query.Add("size", strconv.Itoa(size))
+
+	var url = fmt.Sprintf("http://%s%s?%s", client.host, path, query.Encode())
+
+	var req, _ = http.NewRequest("GET", url, nil)
+	if len(client.key) > 0 {
+		client.signParams(req, path, query)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("get tag (%s) pusher list failed", tag)
+		return
+	}
+	var ret getAllPusherResult
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret.Total, ret.Pushers, nil
+}
+
+// RenameTag rename a tag on every pusher, rename to an exists tag will merge them
+func (client PusherClient) RenameTag(tag, to string) (job pusherLib.BulkJob, err error) {
+	var rsp *http.Response
+	var path = fmt.Sprintf("/pusher/tags/%s/", tag)
+	var form = url.Values{}
+	form.Set("to", to)
+
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if len(client.key) > 0 {
+		client.signParams(req, path, form)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("rename tag (%s) to (%s) failed", tag, to)
+		return
+	}
+	var ret bulkResult
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret.Job, nil
+}
+
+// DeleteTag delete a tag from every pusher
+func (client PusherClient) DeleteTag(tag string) (job pusherLib.BulkJob, err error) {
+	var rsp *http.Response
+	var path = fmt.Sprintf("/pusher/tags/%s/", tag)
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("DELETE", url, nil)
+	if len(client.key) > 0 {
+		client.signPath(req, path)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("delete tag (%s) failed", tag)
+		return
+	}
+	var ret bulkResult
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret.Job, nil
+}
+
+// AnnounceSender announce a sender from a worker instance
+func (client PusherClient) AnnounceSender(info pusherLib.SenderInfo, worker string) (err error) {
+	var rsp *http.Response
+	var path = "/pusher/senders/"
+	var form = url.Values{}
+	form.Set("sender", info.Name)
+	form.Set("worker", worker)
+	for _, field := range info.Fields {
+		form.Add("field", field)
+	}
+	if len(info.Schema) > 0 {
+		form.Set("schema", string(info.Schema))
+	}
+
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if len(client.key) > 0 {
+		client.signParams(req, path, form)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("announce sender (%s) failed", info.Name)
+		return
+	}
+	return nil
+}
+
+// GetSenders get the registered sender list
+func (client PusherClient) GetSenders() (senders []pusherLib.SenderInfo, err error) {
+	var rsp *http.Response
+	var path = "/pusher/senders/"
+	var req, _ = http.NewRequest("GET", "http://"+client.host+path, nil)
+	if len(client.key) > 0 {
+		client.signPath(req, path)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("get sender list failed")
+		return
+	}
+	var ret map[string][]pusherLib.SenderInfo
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret["senders"], nil
+}
+
+// GetQuotas get the sender quota list of the tenant
+func (client PusherClient) GetQuotas() (quotas []pusherLib.Quota, err error) {
+	var rsp *http.Response
+	var path = "/pusher/quotas/"
+	var req, _ = http.NewRequest("GET", "http://"+client.host+path, nil)
+	if len(client.key) > 0 {
+		client.signPath(req, path)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("get quota list failed")
+		return
+	}
+	var ret map[string][]pusherLib.Quota
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret["quotas"], nil
+}
+
+// SetQuota set the daily and monthly quota of a sender, 0 is unlimited
+func (client PusherClient) SetQuota(sender string, daily, monthly int64) (err error) {
+	var rsp *http.Response
+	var path = "/pusher/quotas/" + sender + "/"
+	var form = url.Values{}
+	form.Set("daily", strconv.FormatInt(daily, 10))
+	form.Set("monthly", strconv.FormatInt(monthly, 10))
+
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if len(client.key) > 0 {
+		client.signParams(req, path, form)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("set quota (%s) failed", sender)
+		return
+	}
+	return nil
+}
+
+// TakeCap count a push to the pusher if all the frequency caps are not exceeded
+func (client PusherClient) TakeCap(sender, pusher string, caps []pusherLib.Cap) (ret pusherLib.CapResult, err error) {
+	var rsp *http.Response
+	var path = "/pusher/caps/" + sender + "/"
+	var form = url.Values{}
+	form.Set("pusher", pusher)
+	for _, c := range caps {
+		form.Add("cap", c.String())
+	}
+
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if len(client.key) > 0 {
+		client.signParams(req, path, form)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("take cap (%s) failed", sender)
+		return
+	}
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return
+}
+
+// RefundCap refund a push taken by TakeCap, eg: the push is not delivered
+func (client PusherClient) RefundCap(sender, pusher string, caps []pusherLib.Cap) (err error) {
+	var rsp *http.Response
+	var path = "/pusher/caps/" + sender + "/refund"
+	var form = url.Values{}
+	form.Set("pusher", pusher)
+	for _, c := range caps {
+		form.Add("cap", c.String())
+	}
+
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if len(client.key) > 0 {
+		client.signParams(req, path, form)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("refund cap (%s) failed", sender)
+	}
+	return
+}
+
+// SetDeliveryStatus report the delivery status of a push job
+func (client PusherClient) SetDeliveryStatus(status pusherLib.DeliveryStatus) (err error) {
+	var rsp *http.Response
+	var path = "/pusher/" + status.Sender + "/status"
+	var form = url.Values{}
+	form.Set("name", status.Name)
+	form.Set("pusher", status.Pusher)
+	form.Set("status", status.Status)
+	form.Set("reason", status.Reason)
+	form.Set("counter", strconv.Itoa(status.Counter))
+	if status.Offset > 0 || status.Failed > 0 {
+		form.Set("offset", strconv.Itoa(status.Offset))
+		form.Set("failed", strconv.Itoa(status.Failed))
+	}
+
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if len(client.key) > 0 {
+		client.signParams(req, path, form)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("set delivery status (%s) failed", status.Name)
+		return
+	}
+	return nil
+}
+
+// GetDeliveryStatus get the delivery status of a push job
+func (client PusherClient) GetDeliveryStatus(sender, name string) (status pusherLib.DeliveryStatus, err error) {
+	var rsp *http.Response
+	var path = "/pusher/" + sender + "/status"
+	var query = url.Values{}
+	query.Add("name", name)
+
+	var url = fmt.Sprintf("http://%s%s?%s", client.host, path, query.Encode())
+
+	var req, _ = http.NewRequest("GET", url, nil)
+	if len(client.key) > 0 {
+		client.signParams(req, path, query)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = newStatusError(rsp, fmt.Sprintf("delivery status of job (%s) not exists", name))
+		return
+	}
+	var ret map[string]pusherLib.DeliveryStatus
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret["status"], nil
+}
+
+// DeadLetter a job the worker gave up
+type DeadLetter struct {
+	// Name the periodic job name
+	Name     string
+	Sender   string
+	Pusher   string
+	Data     string
+	Priority string
+	// ExpiresAt the unix time the push is useless, 0 is never expires
+	ExpiresAt int64
+	// Meta the metadata of the push
+	Meta map[string]string
+	Err  string
+}
+
+// AddDeadLetter move a job the worker gave up to the dead letters
+func (client PusherClient) AddDeadLetter(letter DeadLetter) (err error) {
+	var rsp *http.Response
+	var path = "/pusher/deadletters/"
+	var form = url.Values{}
+	form.Set("name", letter.Name)
+	form.Set("sender", letter.Sender)
+	form.Set("pusher", letter.Pusher)
+	form.Set("data", letter.Data)
+	form.Set("priority", letter.Priority)
+	form.Set("err", letter.Err)
+	if letter.ExpiresAt > 0 {
+		form.Set("expiresAt", strconv.FormatInt(letter.ExpiresAt, 10))
+	}
+	if len(letter.Meta) > 0 {
+		meta, _ := json.Marshal(letter.Meta)
+		form.Set("meta", string(meta))
+	}
+
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if len(client.key) > 0 {
+		client.signParams(req, path, form)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("add dead letter (%s) failed", letter.Name)
+		return
+	}
+	return nil
+}
+
+type getDeadLettersResult struct {
+	Letters []pusherLib.DeadLetter `json:"letters"`
+	Total   int                    `json:"total"`
+}
+
+// GetDeadLetters get the dead letter list, filter by the sender if not empty
+func (client PusherClient) GetDeadLetters(sender string, from, size int) (total int, letters []pusherLib.DeadLetter, err error) {
+	var rsp *http.Response
+	var path = "/pusher/deadletters/"
+	var query = url.Values{}
+	if len(sender) > 0 {
+		query.Add("sender", sender)
+	}
+	query.Add("from", strconv.Itoa(from))
+	query.Add("size", strconv.Itoa(size))
+
+	var url = fmt.Sprintf("http://%s%s?%s", client.host, path, query.Encode())
+
+	var req, _ = http.NewRequest("GET", url, nil)
+	if len(client.key) > 0 {
+		client.signParams(req, path, query)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
+		return
+	}
+	defer rsp.Body.Close()
+	if int(rsp.StatusCode/100) != 2 {
+		err = fmt.Errorf("get dead letter list failed")
+		return
+	}
+	var ret getDeadLettersResult
+	decoder := json.NewDecoder(rsp.Body)
+	if err = decoder.Decode(&ret); err != nil {
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
+		return
+	}
+	return ret.Total, ret.Letters, nil
+}
+
+// ReplayDeadLetter resubmit a dead letter, return the periodic job name
+func (client PusherClient) ReplayDeadLetter(id string) (name string, err error) {
+	var rsp *http.Response
+	var path = "/pusher/deadletters/" + id + "/replay"
+	var url = fmt.Sprintf("http://%s%s", client.host, path)
+
+	var req, _ = http.NewRequest("POST", url, nil)
+	if len(client.key) > 0 {
+		client.signPath(req, path)
+	}
+	if rsp, err = client.do(req); err != nil {
+		client.log().Error("http.DefaultClient.Do() failed", "err", err)
 		return
 	}
 	defer rsp.Body.Close()
 	if int(rsp.StatusCode/100) != 2 {
-		err = fmt.Errorf("pushall sender(%s) tag (%s) failed", sender)
+		err = fmt.Errorf("replay dead letter (%s) failed", id)
 		return
 	}
 	var ret pushResult
 	decoder := json.NewDecoder(rsp.Body)
 	if err = decoder.Decode(&ret); err != nil {
-		log.Printf("json.NewDecoder().Decode() failed (%s)", err)
+		client.log().Error("json.NewDecoder().Decode() failed", "err", err)
 		return
 	}
 	return ret.Name, nil
@@ -1,13 +1,21 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/Lupino/go-periodic"
 	"github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/metrics"
 	"github.com/Lupino/pusher/store/boltdb"
+	"github.com/Lupino/pusher/tracing"
+	"github.com/Lupino/pusher/utils"
 	"github.com/codegangsta/negroni"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
 )
 
 var (
@@ -17,6 +25,15 @@ var (
 	key          string
 	prefix       string
 	secret       string
+	legacyAuth   bool
+	rateLimit    string
+	snapshot     bool
+	metricsPath  string
+	otlpEndpoint string
+	otlpInsecure bool
+	traceFile    string
+	logFormat    string
+	logLevel     string
 )
 
 func init() {
@@ -26,6 +43,15 @@ func init() {
 	flag.StringVar(&key, "key", "", "the pusher server app key. (optional)")
 	flag.StringVar(&secret, "secret", "", "the pusher server app secret. (optional)")
 	flag.StringVar(&root, "work_dir", ".", "The pusher work dir.")
+	flag.BoolVar(&legacyAuth, "legacy_auth", false, "accept the legacy hmac md5 signature. (optional)")
+	flag.StringVar(&rateLimit, "rate_limit", "", "the api key rate limit per route class, eg: push=10:20,pushall=1:1 (optional)")
+	flag.BoolVar(&snapshot, "snapshot", false, "embed the pusher snapshot into the push job, the sender skip the pusher lookup. (optional)")
+	flag.StringVar(&metricsPath, "metrics_path", "/metrics", "the prometheus metrics path without auth, empty disable the metrics. (optional)")
+	flag.StringVar(&otlpEndpoint, "otlp_endpoint", "", "export the traces to the otlp http collector, eg: localhost:4318 (optional)")
+	flag.BoolVar(&otlpInsecure, "otlp_insecure", false, "connect the otlp collector without tls. (optional)")
+	flag.StringVar(&traceFile, "trace_file", "", "export the traces to the file as json. (optional)")
+	flag.StringVar(&logFormat, "log_format", "text", "the log format, text or json. (optional)")
+	flag.StringVar(&logLevel, "log_level", "info", "the log level, debug, info, warn or error. (optional)")
 	flag.Parse()
 }
 
@@ -33,6 +59,23 @@ func main() {
 	var err error
 	var storer pusher.Storer
 
+	logger, err := utils.NewLogger(os.Stderr, logFormat, logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+		Service:  "pusher",
+		Endpoint: otlpEndpoint,
+		Insecure: otlpInsecure,
+		File:     traceFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
 	pc := periodic.NewClient()
 	if err = pc.Connect(periodicPort); err != nil {
 		log.Fatal(err)
@@ -57,12 +100,47 @@ func main() {
 
 	sp.SetKey(key)
 	sp.SetSecret(secret)
+	sp.SetLegacyAuth(legacyAuth)
 	sp.SetPrefix(prefix)
+	sp.SetSnapshot(snapshot)
+	sp.SetLogger(logger)
+	var prom *metrics.Prometheus
+	if len(metricsPath) > 0 {
+		prom = metrics.NewPrometheus("pusher")
+		sp.SetMetrics(prom)
+		if err = prom.WatchServer(sp); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, limit := range strings.Split(rateLimit, ",") {
+		var class, rate, burst string
+		if parts := strings.SplitN(limit, "=", 2); len(parts) == 2 {
+			class = parts[0]
+			rate = parts[1]
+		} else {
+			continue
+		}
+		if parts := strings.SplitN(rate, ":", 2); len(parts) == 2 {
+			rate = parts[0]
+			burst = parts[1]
+		}
+		r, _ := strconv.ParseFloat(rate, 64)
+		b, _ := strconv.Atoi(burst)
+		sp.SetRateLimit(class, r, b)
+	}
 
-	n := negroni.New(negroni.NewRecovery(), negroni.NewLogger())
+	n := negroni.New(negroni.NewRecovery(), negroni.HandlerFunc(sp.LogRequest))
 	if len(key) > 0 {
 		n.Use(negroni.HandlerFunc(sp.Auth))
 	}
 	n.UseHandler(sp.NewRouter())
-	n.Run(host)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", sp.HandleHealthz)
+	mux.HandleFunc("/readyz", sp.HandleReadyz)
+	if prom != nil {
+		mux.Handle(metricsPath, prom.Handler())
+	}
+	mux.Handle("/", n)
+	logger.Info("listening", "host", host)
+	log.Fatal(http.ListenAndServe(host, mux))
 }
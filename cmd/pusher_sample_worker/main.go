@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/Lupino/go-periodic"
 	"github.com/Lupino/pusher/worker"
 	"log"
+	"time"
 )
 
 var periodicPort string
@@ -15,15 +17,21 @@ func (p sampleSender) GetName() string {
 	return "sample_sender"
 }
 
-func (p sampleSender) Send(pusher, data string, counter int) (int, error) {
+func (p sampleSender) SendJob(ctx context.Context, job worker.Job) (int, error) {
 
 	// schedlater 10s
-	if data == "1" {
+	if job.Data == "1" {
 		return 10, nil
 	}
 
-	// fail the job
-	// return 0, fmt.Errorf("pusher[%s] do fail", pusher)
+	// pass the ctx to the long call, it is done when the send timeout
+	// req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
+
+	// retry the job with the retry policy
+	// return 0, fmt.Errorf("pusher[%s] do fail", job.Pusher)
+
+	// fail the job without retry
+	// return 0, worker.Permanent(fmt.Errorf("pusher[%s] do fail", job.Pusher))
 
 	// done the job
 	return 0, nil
@@ -41,5 +49,6 @@ func main() {
 	}
 
 	w := worker.New(pw, "", "", "")
-	w.RunSender(sampleSender{})
+	w.SetTimeout("sample_sender", 30*time.Second)
+	w.RunSenderV2(sampleSender{})
 }
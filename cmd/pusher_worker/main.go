@@ -1,21 +1,50 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"github.com/Lupino/go-periodic"
+	"github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/client"
+	"github.com/Lupino/pusher/metrics"
+	"github.com/Lupino/pusher/tracing"
+	"github.com/Lupino/pusher/utils"
 	"github.com/Lupino/pusher/worker"
 	"github.com/Lupino/pusher/worker/senders"
 	"github.com/sendgrid/sendgrid-go"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 type hookConfig struct {
 	Name   string `json:"name"`
 	URL    string `json:"url"`
 	Secret string `json:"secret"`
+	Legacy bool   `json:"legacy"`
+	// Timeout the seconds of a hook request, 0 use the -timeout
+	Timeout int `json:"timeout"`
+	// Concurrency the max concurrent requests of the hook, 0 is unlimited
+	Concurrency int `json:"concurrency"`
+}
+
+type tenantConfig struct {
+	Name          string `json:"name"`
+	SendgridUser  string `json:"sendgrid_user"`
+	SendgridKey   string `json:"sendgrid_key"`
+	From          string `json:"from"`
+	FromName      string `json:"from_name"`
+	AlidayuKey    string `json:"alidayu_key"`
+	AlidayuSecret string `json:"alidayu_secret"`
+	SignName      string `json:"sign_name"`
 }
 
 var (
@@ -31,7 +60,24 @@ var (
 	secret       string
 	retryTimes   int
 	hooksFile    string
+	tenantsFile  string
+	capsConfig   string
+	deferCapped  bool
 	size         int
+	timeout      int
+	drainTimeout int
+	logSends     bool
+	concurrency  string
+	cacheSize    int
+	cacheTTL     int
+	cacheSync    int
+	metricsHost  string
+	healthHost   string
+	otlpEndpoint string
+	otlpInsecure bool
+	traceFile    string
+	logFormat    string
+	logLevel     string
 )
 
 func init() {
@@ -46,24 +92,156 @@ func init() {
 	flag.StringVar(&key, "key", "", "the pusher server app key. (optional)")
 	flag.StringVar(&secret, "secret", "", "the pusher server app secret. (optional)")
 	flag.StringVar(&hooksFile, "hooks", "", "the hook sender config file. (optional)")
+	flag.StringVar(&tenantsFile, "tenants", "", "the tenants to serve with their sendgrid and alidayu config file. (optional)")
+	flag.StringVar(&capsConfig, "caps", "", "the frequency caps per pusher, eg: sendsms=3/3600,sendmail=10/86400 (optional)")
+	flag.StringVar(&concurrency, "concurrency", "", "the max concurrent sends per sender, eg: sendmail=4,sendsms=4 (optional)")
+	flag.IntVar(&cacheSize, "cache_size", 0, "the size of the pusher cache, 0 disable the cache. (optional)")
+	flag.IntVar(&cacheTTL, "cache_ttl", 60, "the seconds a cached pusher expires. (optional)")
+	flag.IntVar(&cacheSync, "cache_sync", 5, "the seconds to poll the pusher changes to invalidate the cache, need an admin key. (optional)")
+	flag.StringVar(&metricsHost, "metrics_host", "", "serve the prometheus metrics on the host, eg: localhost:9100 (optional)")
+	flag.StringVar(&healthHost, "health_host", "", "serve the /healthz and /readyz on the host, same as the metrics_host share the server. (optional)")
+	flag.BoolVar(&deferCapped, "defer_capped", false, "send the capped job later instead of drop it. (optional)")
 	flag.IntVar(&size, "size", runtime.NumCPU()*2, "the size of goroutines. (optional)")
-	flag.IntVar(&retryTimes, "retry_times", 10, "the size of goroutines. (optional)")
+	flag.IntVar(&timeout, "timeout", 60, "the seconds of a send, the pushall sender never timeout. (optional)")
+	flag.IntVar(&drainTimeout, "shutdown_timeout", 30, "the seconds to wait the in-flight sends on SIGINT or SIGTERM. (optional)")
+	flag.BoolVar(&logSends, "log_sends", false, "log every send. (optional)")
+	flag.IntVar(&retryTimes, "retry_times", 10, "the max attempts to send a job. (optional)")
+	flag.StringVar(&otlpEndpoint, "otlp_endpoint", "", "export the traces to the otlp http collector, eg: localhost:4318 (optional)")
+	flag.BoolVar(&otlpInsecure, "otlp_insecure", false, "connect the otlp collector without tls. (optional)")
+	flag.StringVar(&traceFile, "trace_file", "", "export the traces to the file as json. (optional)")
+	flag.StringVar(&logFormat, "log_format", "text", "the log format, text or json. (optional)")
+	flag.StringVar(&logLevel, "log_level", "info", "the log level, debug, info, warn or error. (optional)")
 	flag.Parse()
 }
 
 func main() {
+	logger, err := utils.NewLogger(os.Stderr, logFormat, logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.Options{
+		Service:  "pusher_worker",
+		Endpoint: otlpEndpoint,
+		Insecure: otlpInsecure,
+		File:     traceFile,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
 	pw := periodic.NewWorker(size)
 	if err := pw.Connect(periodicPort); err != nil {
 		log.Fatal(err)
 	}
 
-	w := worker.New(pw, pusherHost, key, secret, uint(retryTimes))
+	w := worker.New(pw, pusherHost, key, secret)
+	w.SetPeriodicPort(periodicPort)
+	w.SetMaxTryTimes(uint(retryTimes))
+	w.SetSize(size)
+	w.SetLogger(logger)
+	var muxes = make(map[string]*http.ServeMux)
+	getMux := func(host string) *http.ServeMux {
+		if _, ok := muxes[host]; !ok {
+			muxes[host] = http.NewServeMux()
+		}
+		return muxes[host]
+	}
+	if len(metricsHost) > 0 {
+		prom := metrics.NewWorkerPrometheus("pusher_worker")
+		w.SetMetrics(prom)
+		getMux(metricsHost).Handle("/metrics", prom.Handler())
+	}
+	if len(healthHost) > 0 {
+		mux := getMux(healthHost)
+		mux.HandleFunc("/healthz", w.HandleHealthz)
+		mux.HandleFunc("/readyz", w.HandleReadyz)
+	}
+	for host, mux := range muxes {
+		go func(host string, mux *http.ServeMux) {
+			log.Fatal(http.ListenAndServe(host, mux))
+		}(host, mux)
+	}
+	if cacheSize > 0 {
+		w.SetPusherCache(client.NewLRUCache(cacheSize, time.Duration(cacheTTL)*time.Second), time.Duration(cacheSync)*time.Second)
+	}
+	w.Use(worker.Recovery())
+	if logSends {
+		w.Use(worker.Logging())
+	}
+	var sendTimeout = time.Duration(timeout) * time.Second
+	var action = worker.CapDrop
+	if deferCapped {
+		action = worker.CapDefer
+	}
+	var caps = make(map[string][]pusher.Cap)
+	for _, config := range strings.Split(capsConfig, ",") {
+		parts := strings.SplitN(config, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		c, err := pusher.ParseCap(parts[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		caps[parts[0]] = append(caps[parts[0]], c)
+	}
+	for sender, c := range caps {
+		w.SetCaps(sender, action, c...)
+	}
+	for _, config := range strings.Split(concurrency, ",") {
+		parts := strings.SplitN(config, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		w.SetConcurrency(parts[0], n)
+	}
+
+	// the sendgrid client can't be cancelled, give up the request on the send timeout
+	var sgClient = &http.Client{Timeout: sendTimeout}
 	var sg = sendgrid.NewSendGridClient(sgUser, sgKey)
+	sg.Client = sgClient
 	var mailSender = senders.NewMailSender(w, sg, from, fromName)
 	var smsSender = senders.NewSMSSender(w, dayuKey, dayuSecret)
 	var pushAllSender = senders.NewPushAllSender(w)
+	w.SetTimeout(mailSender.GetName(), sendTimeout)
+	w.SetTimeout(smsSender.GetName(), sendTimeout)
+	// the pushall sender push to all the pushers, it may take long
+	w.SetTimeout(pushAllSender.GetName(), 0)
+
+	if len(tenantsFile) > 0 {
+		var tenantsConfig []tenantConfig
+		file, err := os.Open(tenantsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		decoder := json.NewDecoder(file)
+		if err = decoder.Decode(&tenantsConfig); err != nil {
+			logger.Error("json.NewDecoder().Decode() failed", "file", tenantsFile, "err", err)
+			return
+		}
+		var tenants []string
+		for _, config := range tenantsConfig {
+			tenants = append(tenants, config.Name)
+			if len(config.SendgridUser) > 0 {
+				tsg := sendgrid.NewSendGridClient(config.SendgridUser, config.SendgridKey)
+				tsg.Client = sgClient
+				mailSender.SetTenant(config.Name, tsg, config.From, config.FromName)
+			}
+			if len(config.AlidayuKey) > 0 {
+				smsSender.SetTenant(config.Name, config.AlidayuKey, config.AlidayuSecret, config.SignName)
+			}
+		}
+		w.SetTenants(tenants...)
+	}
 
-	var hooks []worker.Sender
+	var hooks []worker.SenderV2
 	if len(hooksFile) > 0 {
 		var hooksConfig []hookConfig
 		file, err := os.Open(hooksFile)
@@ -72,14 +250,34 @@ func main() {
 		}
 		decoder := json.NewDecoder(file)
 		if err = decoder.Decode(&hooksConfig); err != nil {
-			log.Printf("json.NewDecoder().Decode() failed (%s)", err)
+			logger.Error("json.NewDecoder().Decode() failed", "file", hooksFile, "err", err)
 			return
 		}
 		for _, config := range hooksConfig {
 			hook := senders.NewHookSender(w, config.Name, config.URL, config.Secret)
+			hook.SetLegacySign(config.Legacy)
+			if config.Concurrency > 0 {
+				w.SetConcurrency(config.Name, config.Concurrency)
+			}
+			if config.Timeout > 0 {
+				w.SetTimeout(config.Name, time.Duration(config.Timeout)*time.Second)
+			} else {
+				w.SetTimeout(config.Name, sendTimeout)
+			}
 			hooks = append(hooks, hook)
 		}
 	}
 	hooks = append(hooks, mailSender, smsSender, pushAllSender)
-	w.RunSender(hooks...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := w.Run(ctx, hooks...); err != nil {
+		log.Fatal(err)
+	}
+	logger.Info("Shutting down, wait the in-flight sends", "timeout", drainTimeout)
+	sctx, cancel := context.WithTimeout(context.Background(), time.Duration(drainTimeout)*time.Second)
+	defer cancel()
+	if err := w.Shutdown(sctx); err != nil {
+		logger.Error("worker.Worker.Shutdown() failed", "err", err)
+	}
 }
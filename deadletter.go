@@ -0,0 +1,96 @@
+package pusher
+
+import (
+	"encoding/json"
+	"github.com/Lupino/pusher/utils"
+	"sort"
+	"strings"
+)
+
+// DeadLetter a job the worker gave up, exhausted the attempts or failed permanently
+type DeadLetter struct {
+	// ID the periodic job name without the tenant
+	ID     string `json:"id"`
+	Sender string `json:"sender"`
+	// Pusher the pusher, or the sender of a pushall job
+	Pusher   string `json:"pusher"`
+	Data     string `json:"data"`
+	Priority string `json:"priority,omitempty"`
+	// ExpiresAt the unix time the push is useless, 0 is never expires
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// Meta the metadata of the push
+	Meta map[string]string `json:"meta,omitempty"`
+	Err  string            `json:"err"`
+	// History the delivery decisions of the job
+	History   []DeliveryAttempt `json:"history,omitempty"`
+	CreatedAt int64             `json:"createdAt"`
+}
+
+// deadLetterStore persist the dead letters of every tenant by the qualified job name
+type deadLetterStore struct {
+	bucket Bucket
+}
+
+func newDeadLetterStore(bucket Bucket) *deadLetterStore {
+	return &deadLetterStore{bucket: bucket}
+}
+
+func (ds *deadLetterStore) add(tenant string, letter DeadLetter) error {
+	data, _ := json.Marshal(letter)
+	return ds.bucket.Put(utils.JoinTenant(tenant, letter.ID), data)
+}
+
+func (ds *deadLetterStore) get(tenant, id string) (letter DeadLetter, ok bool, err error) {
+	var data []byte
+	if data, err = ds.bucket.Get(utils.JoinTenant(tenant, id)); err != nil || data == nil {
+		return
+	}
+	if err = json.Unmarshal(data, &letter); err != nil {
+		return
+	}
+	return letter, true, nil
+}
+
+func (ds *deadLetterStore) remove(tenant, id string) error {
+	return ds.bucket.Delete(utils.JoinTenant(tenant, id))
+}
+
+// list the dead letters of the tenant, the newest first, filter by the sender if not empty
+func (ds *deadLetterStore) list(tenant, sender string) ([]DeadLetter, error) {
+	var letters = make([]DeadLetter, 0)
+	err := ds.bucket.ForEach(func(key string, value []byte) error {
+		if t, _ := utils.SplitTenant(key); t != tenant {
+			return nil
+		}
+		var letter DeadLetter
+		if err := json.Unmarshal(value, &letter); err != nil {
+			return err
+		}
+		if sender != "" && letter.Sender != sender {
+			return nil
+		}
+		letters = append(letters, letter)
+		return nil
+	})
+	sort.SliceStable(letters, func(i, j int) bool {
+		if letters[i].CreatedAt == letters[j].CreatedAt {
+			return strings.Compare(letters[i].ID, letters[j].ID) < 0
+		}
+		return letters[i].CreatedAt > letters[j].CreatedAt
+	})
+	return letters, err
+}
+
+// purge the dead letters of the tenant, filter by the sender if not empty
+func (ds *deadLetterStore) purge(tenant, sender string) (int, error) {
+	letters, err := ds.list(tenant, sender)
+	if err != nil {
+		return 0, err
+	}
+	for i, letter := range letters {
+		if err = ds.remove(tenant, letter.ID); err != nil {
+			return i, err
+		}
+	}
+	return len(letters), nil
+}
@@ -0,0 +1,69 @@
+package pusher
+
+import (
+	"errors"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestReplayDeadLetter(t *testing.T) {
+	var tests = []struct {
+		name   string
+		letter DeadLetter
+		key    *APIKey
+		err    error
+		code   int
+		jobs   int
+		kept   bool
+		used   int64
+	}{
+		{"replay", DeadLetter{ID: "4711_1", Sender: "sendsms", Pusher: "4711", Data: "hello"}, nil, nil, http.StatusOK, 1, false, 1},
+		{"pushall", DeadLetter{ID: "sendsms_1", Sender: "pushall", Pusher: "sendsms", Data: "hello"}, nil, nil, http.StatusOK, 1, false, 0},
+		{"expired", DeadLetter{ID: "4711_1", Sender: "sendsms", Pusher: "4711", Data: "hello", ExpiresAt: time.Now().Unix() - 1}, nil, nil, http.StatusGone, 0, true, 0},
+		{"not allowed", DeadLetter{ID: "4711_1", Sender: "sendsms", Pusher: "4711", Data: "hello"}, &APIKey{Key: "key", Senders: []string{"sendmail"}}, nil, http.StatusForbidden, 0, true, 0},
+		{"pushall not allowed", DeadLetter{ID: "sendsms_1", Sender: "pushall", Pusher: "sendsms", Data: "hello"}, &APIKey{Key: "key", Senders: []string{"pushall"}}, nil, http.StatusForbidden, 0, true, 0},
+		{"submit failed", DeadLetter{ID: "4711_1", Sender: "sendsms", Pusher: "4711", Data: "hello"}, nil, errors.New("periodic unavailable"), http.StatusInternalServerError, 0, true, 0},
+	}
+	for _, test := range tests {
+		sp, p := newTestSPusher(t)
+		sp.quotas.set("", "sendsms", 10, 0)
+		if err := sp.letters.add("", test.letter); err != nil {
+			t.Fatal(err)
+		}
+		p.err = test.err
+		rec := httptest.NewRecorder()
+		req := postForm("/pusher/deadletters/"+test.letter.ID+"/replay", url.Values{}, test.key)
+		sp.handleReplayDeadLetter(rec, mux.SetURLVars(req, map[string]string{"id": test.letter.ID}))
+		if rec.Code != test.code {
+			t.Errorf("%s: status %d, want %d: %s", test.name, rec.Code, test.code, rec.Body)
+		}
+		if jobs := p.submitted(); len(jobs) != test.jobs {
+			t.Errorf("%s: submitted %d jobs, want %d", test.name, len(jobs), test.jobs)
+		} else if test.jobs > 0 && jobs[0].Func != "pusher:"+test.letter.Sender {
+			t.Errorf("%s: submitted to %s, want the sender %s", test.name, jobs[0].Func, test.letter.Sender)
+		}
+		if _, ok, _ := sp.letters.get("", test.letter.ID); ok != test.kept {
+			t.Errorf("%s: the dead letter kept %v, want %v", test.name, ok, test.kept)
+		}
+		if q := sp.quotas.all("")[0]; q.DayUsed != test.used {
+			t.Errorf("%s: the quota used %d, want %d", test.name, q.DayUsed, test.used)
+		}
+	}
+}
+
+func TestReplayDeadLetterMissing(t *testing.T) {
+	sp, p := newTestSPusher(t)
+	rec := httptest.NewRecorder()
+	req := postForm("/pusher/deadletters/4711_1/replay", url.Values{}, nil)
+	sp.handleReplayDeadLetter(rec, mux.SetURLVars(req, map[string]string{"id": "4711_1"}))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if jobs := p.submitted(); len(jobs) != 0 {
+		t.Errorf("no job should be submitted, got %+v", jobs)
+	}
+}
@@ -0,0 +1,137 @@
+package pusher
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// delivery status
+const (
+	DeliverySent     = "sent"
+	DeliveryFailed   = "failed"
+	DeliveryRetry    = "retry"
+	DeliveryDropped  = "dropped"
+	DeliveryDeferred = "deferred"
+	DeliveryExpired  = "expired"
+)
+
+// deliveryRetention how long the delivery status is kept
+const deliveryRetention = 7 * 24 * time.Hour
+
+// deliveryMaxHistory the max attempts kept in the delivery history
+const deliveryMaxHistory = 20
+
+// DeliveryAttempt a delivery decision in the history
+type DeliveryAttempt struct {
+	Status  string `json:"status"`
+	Reason  string `json:"reason,omitempty"`
+	Counter int    `json:"counter"`
+	At      int64  `json:"at"`
+}
+
+// DeliveryStatus the last delivery decision of a push job reported by the worker
+type DeliveryStatus struct {
+	// Name the periodic job name
+	Name   string `json:"name"`
+	Sender string `json:"sender"`
+	Pusher string `json:"pusher"`
+	Status string `json:"status"`
+	// Reason why the job is failed, dropped or deferred, eg: the exceeded cap
+	Reason    string `json:"reason,omitempty"`
+	Counter   int    `json:"counter"`
+	UpdatedAt int64  `json:"updatedAt"`
+	// Offset the progress of a job push to many pushers, eg: pushall, the pushers already handled
+	Offset int `json:"offset,omitempty"`
+	// Failed the pushers failed to push of the job
+	Failed int `json:"failed,omitempty"`
+	// History the delivery decisions of the job, the latest is the last
+	History []DeliveryAttempt `json:"history,omitempty"`
+}
+
+// deliveryStore persist the delivery status by sender and job name
+type deliveryStore struct {
+	locker sync.Mutex
+	bucket Bucket
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func newDeliveryStore(bucket Bucket) *deliveryStore {
+	ds := &deliveryStore{bucket: bucket, stop: make(chan struct{})}
+	go ds.expire()
+	return ds
+}
+
+// close stop the expire goroutine
+func (ds *deliveryStore) close() {
+	ds.once.Do(func() {
+		close(ds.stop)
+	})
+}
+
+// set the delivery status, append it to the history of the job
+func (ds *deliveryStore) set(status DeliveryStatus) error {
+	ds.locker.Lock()
+	defer ds.locker.Unlock()
+	last, ok, err := ds.get(status.Sender, status.Name)
+	if err != nil {
+		return err
+	}
+	if ok {
+		status.History = last.History
+	}
+	status.History = append(status.History, DeliveryAttempt{
+		Status:  status.Status,
+		Reason:  status.Reason,
+		Counter: status.Counter,
+		At:      status.UpdatedAt,
+	})
+	if len(status.History) > deliveryMaxHistory {
+		status.History = status.History[len(status.History)-deliveryMaxHistory:]
+	}
+	data, _ := json.Marshal(status)
+	return ds.bucket.Put(status.Sender+":"+status.Name, data)
+}
+
+func (ds *deliveryStore) get(sender, name string) (status DeliveryStatus, ok bool, err error) {
+	var data []byte
+	if data, err = ds.bucket.Get(sender + ":" + name); err != nil || data == nil {
+		return
+	}
+	if err = json.Unmarshal(data, &status); err != nil {
+		return
+	}
+	return status, true, nil
+}
+
+// expire remove the delivery status out of the retention every hour until close
+func (ds *deliveryStore) expire() {
+	var ticker = time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		var expired []string
+		var deadline = time.Now().Add(-deliveryRetention).Unix()
+		err := ds.bucket.ForEach(func(key string, value []byte) error {
+			var status DeliveryStatus
+			if json.Unmarshal(value, &status) != nil || status.UpdatedAt < deadline {
+				expired = append(expired, key)
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("Bucket.ForEach() failed", "err", err)
+		}
+		for _, key := range expired {
+			if err = ds.bucket.Delete(key); err != nil {
+				slog.Error("Bucket.Delete() failed", "err", err)
+			}
+		}
+		select {
+		case <-ds.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
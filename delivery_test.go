@@ -0,0 +1,38 @@
+package pusher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeliveryStoreClose(t *testing.T) {
+	var ds = &deliveryStore{bucket: newMemoryBucket(), stop: make(chan struct{})}
+	var done = make(chan struct{})
+	go func() {
+		ds.expire()
+		close(done)
+	}()
+	ds.close()
+	ds.close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the expire goroutine should stop on close")
+	}
+}
+
+func TestCloseTenants(t *testing.T) {
+	sp, _ := newTestSPusher(t)
+	for _, tenant := range []string{"", "acme", "shop"} {
+		if _, err := sp.tenants.router(sp, tenant); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(sp.tenants.indexes); n != 2 {
+		t.Fatalf("opened %d tenant indexes, want 2", n)
+	}
+	sp.Close()
+	if n := len(sp.tenants.indexes); n != 0 {
+		t.Fatalf("the tenant indexes should be closed, %d left", n)
+	}
+}
@@ -0,0 +1,57 @@
+package pusher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBindExpiresAt(t *testing.T) {
+	var (
+		now   = time.Now().Unix()
+		sched = strconv.FormatInt(now+3600, 10)
+	)
+	var tests = []struct {
+		name    string
+		form    url.Values
+		schedat string
+		ok      bool
+		want    int64
+	}{
+		{"none", url.Values{}, "", true, 0},
+		{"expiresAt", url.Values{"expiresAt": {"1456403493"}}, "", true, 1456403493},
+		{"expiresAt over ttl", url.Values{"expiresAt": {"1456403493"}, "ttl": {"60"}}, "", true, 1456403493},
+		{"ttl", url.Values{"ttl": {"60"}}, "", true, now + 60},
+		{"ttl from schedat", url.Values{"ttl": {"60"}}, sched, true, now + 3660},
+		{"ttl from past schedat", url.Values{"ttl": {"60"}}, "1456403493", true, now + 60},
+		{"invalid expiresAt", url.Values{"expiresAt": {"tomorrow"}}, "", false, 0},
+		{"negative expiresAt", url.Values{"expiresAt": {"-1"}}, "", false, 0},
+		{"zero ttl", url.Values{"ttl": {"0"}}, "", false, 0},
+		{"invalid ttl", url.Values{"ttl": {"1h"}}, "", false, 0},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("POST", "/pusher/sendmail/push", strings.NewReader(test.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		params, err := readParams(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		got, ok := bindExpiresAt(rec, params, test.schedat)
+		if ok != test.ok {
+			t.Errorf("%s: ok %v, want %v: %s", test.name, ok, test.ok, rec.Body)
+			continue
+		}
+		if !ok && rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status %d, want %d", test.name, rec.Code, http.StatusUnprocessableEntity)
+		}
+		// the ttl may cross a second while the test runs
+		if got < test.want || got > test.want+1 || (test.want == 0 && got != 0) {
+			t.Errorf("%s: expiresAt %d, want %d", test.name, got, test.want)
+		}
+	}
+}
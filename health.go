@@ -0,0 +1,90 @@
+package pusher
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// healthTimeout the max time of a dependency check
+const healthTimeout = 5 * time.Second
+
+// HealthCheck the result of a dependency check
+type HealthCheck struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	Err  string `json:"err,omitempty"`
+	// Elapsed the milliseconds of the check
+	Elapsed int64 `json:"elapsed"`
+}
+
+// pingStorer ping the storer if it is a Pinger, otherwise read the pusher total
+func pingStorer(storer Storer) error {
+	if p, ok := storer.(Pinger); ok {
+		return p.Ping()
+	}
+	_, _, err := storer.GetAll(0, 0)
+	return err
+}
+
+// check run the dependency check with the health timeout
+func check(name string, fn func() error) HealthCheck {
+	var start = time.Now()
+	var done = make(chan error, 1)
+	go func() {
+		done <- fn()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(healthTimeout):
+		err = errors.New("timeout")
+	}
+	ret := HealthCheck{Name: name, OK: err == nil, Elapsed: time.Since(start).Nanoseconds() / int64(time.Millisecond)}
+	if err != nil {
+		ret.Err = err.Error()
+	}
+	return ret
+}
+
+// Check the storer, the search index and the periodic connection, return false if any failed
+func (s SPusher) Check() ([]HealthCheck, bool) {
+	var checks = []HealthCheck{
+		check("storer", func() error {
+			return pingStorer(s.storer)
+		}),
+		check("index", func() error {
+			_, err := s.index.DocCount()
+			return err
+		}),
+		check("periodic", func() error {
+			if !s.p.Ping() {
+				return errors.New("periodic not reachable")
+			}
+			return nil
+		}),
+	}
+	for _, c := range checks {
+		if !c.OK {
+			return checks, false
+		}
+	}
+	return checks, true
+}
+
+// HandleHealthz reply ok when the server is alive, serve it without the Auth middleware
+func (s SPusher) HandleHealthz(w http.ResponseWriter, req *http.Request) {
+	sendJSONResponse(w, http.StatusOK, "status", "ok")
+}
+
+// HandleReadyz check the dependencies, reply 503 if any failed, serve it without the Auth middleware
+func (s SPusher) HandleReadyz(w http.ResponseWriter, req *http.Request) {
+	checks, ok := s.Check()
+	var status = http.StatusOK
+	var result = "ok"
+	if !ok {
+		status = http.StatusServiceUnavailable
+		result = "unavailable"
+	}
+	sendJSONResponse(w, status, "", map[string]interface{}{"status": result, "checks": checks})
+}
@@ -1,21 +1,145 @@
 package pusher
 
 import (
+	"encoding/json"
 	"github.com/blevesearch/bleve"
+	"github.com/blevesearch/bleve/analysis/analyzer/keyword"
 	"github.com/blevesearch/bleve/mapping"
+	"github.com/blevesearch/bleve/search/query"
+	"log/slog"
+	"os"
 )
 
+// TagCount a tag with the count of pushers which has the tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
 func createMapping() mapping.IndexMapping {
+	// index tags and senders as a whole term, so we can facet and match them exactly
+	keywordFieldMapping := bleve.NewTextFieldMapping()
+	keywordFieldMapping.Analyzer = keyword.Name
+
+	pusherMapping := bleve.NewDocumentMapping()
+	pusherMapping.AddFieldMappingsAt("tags", keywordFieldMapping)
+	pusherMapping.AddFieldMappingsAt("senders", keywordFieldMapping)
+
 	mapping := bleve.NewIndexMapping()
+	mapping.DefaultMapping = pusherMapping
 	return mapping
 }
 
-func openIndex(path string) (index bleve.Index, err error) {
-	if index, err = bleve.Open(path); err != nil {
-		mapping := createMapping()
-		if index, err = bleve.New(path, mapping); err != nil {
+const (
+	// reindexSize the pushers per batch of rebuildIndex
+	reindexSize = 100
+	// reindexLogEvery log the progress of rebuildIndex every the pushers
+	reindexLogEvery = 10000
+)
+
+// openIndex open the index, build it from the pushers of the storer if the path does not exist,
+// the other errors are returned to keep the index, eg: a corrupted or locked index.
+// The index created by an older pusher, which analyze the tags, is rebuilt from the pushers of the storer
+func openIndex(path string, storer Storer) (index bleve.Index, err error) {
+	if index, err = bleve.Open(path); err == bleve.ErrorIndexPathDoesNotExist {
+		return rebuildIndex(path, storer)
+	}
+	if err != nil {
+		return
+	}
+	if index.Mapping().AnalyzerNameForPath("tags") == keyword.Name {
+		return
+	}
+	slog.Warn("the index analyze the tags, rebuild it", "path", path)
+	if err = index.Close(); err != nil {
+		return
+	}
+	return rebuildIndex(path, storer)
+}
+
+// rebuildIndex create the index with the mapping aside, index the pushers of the storer,
+// then replace the old index with it if any
+func rebuildIndex(path string, storer Storer) (index bleve.Index, err error) {
+	var building = path + ".rebuild"
+	if err = os.RemoveAll(building); err != nil {
+		return
+	}
+	if index, err = bleve.New(building, createMapping()); err != nil {
+		return
+	}
+	var (
+		total   uint64
+		pushers []Pusher
+		logged  int
+	)
+	for from := 0; from == 0 || uint64(from) < total; from += reindexSize {
+		if from-logged >= reindexLogEvery {
+			slog.Info("rebuilding the index", "path", path, "indexed", from, "total", total)
+			logged = from
+		}
+		if total, pushers, err = storer.GetAll(from, reindexSize); err != nil {
+			index.Close()
+			return
+		}
+		batch := index.NewBatch()
+		for _, p := range pushers {
+			if err = batch.Index(p.ID, p); err != nil {
+				index.Close()
+				return
+			}
+		}
+		if err = index.Batch(batch); err != nil {
+			index.Close()
 			return
 		}
 	}
-	return
+	if err = index.Close(); err != nil {
+		return
+	}
+	if err = os.Rename(path, path+".old"); err != nil && !os.IsNotExist(err) {
+		return
+	}
+	if err = os.Rename(building, path); err != nil {
+		return
+	}
+	if err = os.RemoveAll(path + ".old"); err != nil {
+		return
+	}
+	slog.Info("the index is rebuilt", "path", path, "total", total)
+	return bleve.Open(path)
+}
+
+// parseQuery parse a query json object, otherwise use it as a query string
+func parseQuery(q string) query.Query {
+	qr, err := query.ParseQuery([]byte(q))
+	if err != nil {
+		qr = bleve.NewQueryStringQuery(q)
+	}
+	return qr
+}
+
+// tagQuery return a query json object which match the pushers has the tag
+func tagQuery(tag string) string {
+	q, _ := json.Marshal(map[string]string{"term": tag, "field": "tags"})
+	return string(q)
+}
+
+// tagCounts facet the tags field, return the top size tags
+// and the count of the other tags pusher
+func (s SPusher) tagCounts(size int) (tags []TagCount, other int, err error) {
+	var searchResult *bleve.SearchResult
+	searchRequest := bleve.NewSearchRequestOptions(bleve.NewMatchAllQuery(), 0, 0, false)
+	searchRequest.AddFacet("tags", bleve.NewFacetRequest("tags", size))
+	if searchResult, err = s.index.Search(searchRequest); err != nil {
+		return
+	}
+	tags = make([]TagCount, 0)
+	facet, ok := searchResult.Facets["tags"]
+	if !ok {
+		return
+	}
+	for _, term := range facet.Terms {
+		tags = append(tags, TagCount{Tag: term.Term, Count: term.Count})
+	}
+	return tags, facet.Other, nil
 }
@@ -0,0 +1,38 @@
+package pusher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenIndex(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "index")
+	index, err := openIndex(path, newMemStorer())
+	if err != nil {
+		t.Fatalf("the index should be created, got %v", err)
+	}
+	index.Close()
+	if index, err = openIndex(path, newMemStorer()); err != nil {
+		t.Fatalf("the index should be opened, got %v", err)
+	}
+	index.Close()
+}
+
+// an index can not be opened is kept, the pushers are not searchable until it is fixed
+func TestOpenIndexKeepBroken(t *testing.T) {
+	var path = filepath.Join(t.TempDir(), "index")
+	if err := os.MkdirAll(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	var store = filepath.Join(path, "store")
+	if err := os.WriteFile(store, []byte("pushers"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openIndex(path, newMemStorer()); err == nil {
+		t.Fatal("the broken index should not be opened")
+	}
+	if data, err := os.ReadFile(store); err != nil || string(data) != "pushers" {
+		t.Fatalf("the broken index should be kept, got %q %v", data, err)
+	}
+}
@@ -0,0 +1,175 @@
+package pusher
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// api key scopes
+const (
+	ScopeReadPushers  = "read:pushers"
+	ScopeWritePushers = "write:pushers"
+	ScopePush         = "push"
+	ScopePushAll      = "pushall"
+	ScopeCancel       = "cancel"
+	// ScopeAdmin has all the scopes, and manage the api keys and senders
+	ScopeAdmin = "admin"
+)
+
+// Scopes all the api key scopes
+var Scopes = []string{
+	ScopeReadPushers,
+	ScopeWritePushers,
+	ScopePush,
+	ScopePushAll,
+	ScopeCancel,
+	ScopeAdmin,
+}
+
+// APIKey an api key with scopes
+type APIKey struct {
+	Key    string   `json:"key"`
+	Secret string   `json:"secret,omitempty"`
+	Label  string   `json:"label"`
+	Scopes []string `json:"scopes"`
+	// Senders the allowed senders, empty is allow all senders
+	Senders []string `json:"senders,omitempty"`
+	// Tenant the key only use the pushers of the tenant, empty is the default tenant
+	Tenant string `json:"tenant,omitempty"`
+	// RateLimits the rate limit per route class, override the server default
+	RateLimits map[string]RateLimit `json:"rateLimits,omitempty"`
+	ExpiresAt  int64                `json:"expiresAt,omitempty"`
+	Revoked    bool                 `json:"revoked"`
+	CreatedAt  int64                `json:"createdAt"`
+}
+
+// HasScope on an api key, the admin scope has all scopes
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowSender on an api key
+func (k APIKey) AllowSender(sender string) bool {
+	if len(k.Senders) == 0 {
+		return true
+	}
+	for _, s := range k.Senders {
+		if s == sender {
+			return true
+		}
+	}
+	return false
+}
+
+// Expired api key
+func (k APIKey) Expired() bool {
+	return k.ExpiresAt > 0 && k.ExpiresAt <= time.Now().Unix()
+}
+
+func validScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func randomHex(size int) string {
+	var buf = make([]byte, size)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+type keyStore struct {
+	locker sync.RWMutex
+	keys   map[string]APIKey
+	bucket Bucket
+}
+
+func newKeyStore(bucket Bucket) (*keyStore, error) {
+	var ks = &keyStore{keys: make(map[string]APIKey), bucket: bucket}
+	err := bucket.ForEach(func(key string, value []byte) error {
+		var k APIKey
+		if err := json.Unmarshal(value, &k); err != nil {
+			return err
+		}
+		ks.keys[key] = k
+		return nil
+	})
+	return ks, err
+}
+
+func (ks *keyStore) set(k APIKey) error {
+	ks.locker.Lock()
+	defer ks.locker.Unlock()
+	data, _ := json.Marshal(k)
+	if err := ks.bucket.Put(k.Key, data); err != nil {
+		return err
+	}
+	ks.keys[k.Key] = k
+	return nil
+}
+
+func (ks *keyStore) get(key string) (k APIKey, ok bool) {
+	ks.locker.RLock()
+	defer ks.locker.RUnlock()
+	k, ok = ks.keys[key]
+	return
+}
+
+func (ks *keyStore) del(key string) error {
+	ks.locker.Lock()
+	defer ks.locker.Unlock()
+	if err := ks.bucket.Delete(key); err != nil {
+		return err
+	}
+	delete(ks.keys, key)
+	return nil
+}
+
+func (ks *keyStore) all() []APIKey {
+	ks.locker.RLock()
+	defer ks.locker.RUnlock()
+	var keys = make([]APIKey, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt < keys[j].CreatedAt
+	})
+	return keys
+}
+
+// getKey find the api key, the key from SetKey is an admin key
+func (s SPusher) getKey(key string) (APIKey, bool) {
+	if len(s.key) > 0 && key == s.key {
+		return APIKey{Key: s.key, Secret: s.secret, Label: "root", Scopes: []string{ScopeAdmin}}, true
+	}
+	return s.keys.get(key)
+}
+
+type contextKey int
+
+const apiKeyContextKey contextKey = 0
+
+func withAPIKey(req *http.Request, k APIKey) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), apiKeyContextKey, k))
+}
+
+// requestKey return the api key which authed the request
+func requestKey(req *http.Request) (APIKey, bool) {
+	k, ok := req.Context().Value(apiKeyContextKey).(APIKey)
+	return k, ok
+}
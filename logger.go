@@ -0,0 +1,63 @@
+package pusher
+
+import (
+	"context"
+	"github.com/Lupino/pusher/utils"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type loggerKey struct{}
+
+// SetLogger set the structured logger of the server, the default is slog.Default()
+func (s *SPusher) SetLogger(logger *slog.Logger) {
+	s.logger = logger
+}
+
+// withRequestID attach the request id of the X-Request-Id header or a new one to the request logger,
+// reply the request id with the X-Request-Id header
+func (s SPusher) withRequestID(w http.ResponseWriter, req *http.Request) (*http.Request, *slog.Logger) {
+	if logger, ok := req.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		return req, logger
+	}
+	var id = req.Header.Get("X-Request-Id")
+	if id == "" {
+		id = utils.Nonce()
+	}
+	w.Header().Set("X-Request-Id", id)
+	logger := s.logger.With("request_id", id)
+	return req.WithContext(context.WithValue(req.Context(), loggerKey{}, logger)), logger
+}
+
+// LogRequest log every request with the request id, negroni middleware
+func (s SPusher) LogRequest(w http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+	var start = time.Now()
+	req, logger := s.withRequestID(w, req)
+	var sw = &statusWriter{ResponseWriter: w, status: http.StatusOK}
+	next(sw, req)
+	logger.Info("request", "method", req.Method, "path", req.URL.Path, "status", sw.status, "elapsed", time.Since(start))
+}
+
+// routeLogger attach the tenant and the route vars, eg: pusher, sender, to the request logger
+func (s SPusher) routeLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		req, logger := s.withRequestID(w, req)
+		if s.tenant != "" {
+			logger = logger.With("tenant", s.tenant)
+		}
+		for k, v := range mux.Vars(req) {
+			logger = logger.With(k, v)
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), loggerKey{}, logger)))
+	})
+}
+
+// reqLogger the logger of the request
+func (s SPusher) reqLogger(req *http.Request) *slog.Logger {
+	if logger, ok := req.Context().Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return s.logger
+}
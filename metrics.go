@@ -0,0 +1,199 @@
+package pusher
+
+import (
+	"github.com/blevesearch/bleve"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// Metrics collect the metrics of the pusher server, see the metrics package for prometheus
+type Metrics interface {
+	// ObserveRequest a request of the route template, eg: /pusher/pushers/{pusher}/
+	ObserveRequest(route, method string, status int, elapsed time.Duration)
+	// IncSubmit count a job submitted to periodic, the kind is push or pushall
+	IncSubmit(kind, sender string)
+	// IncSubmitError count a job failed to submit to periodic
+	IncSubmitError(kind, sender string)
+	// ObserveStorer an operation of the storer, eg: get, set, del
+	ObserveStorer(op string, elapsed time.Duration, err error)
+	// ObserveIndex an operation of the bleve index, eg: index, search
+	ObserveIndex(op string, elapsed time.Duration, err error)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveRequest(route, method string, status int, elapsed time.Duration) {}
+func (nopMetrics) IncSubmit(kind, sender string)                                          {}
+func (nopMetrics) IncSubmitError(kind, sender string)                                     {}
+func (nopMetrics) ObserveStorer(op string, elapsed time.Duration, err error)              {}
+func (nopMetrics) ObserveIndex(op string, elapsed time.Duration, err error)               {}
+
+// SetMetrics collect the metrics of the server, the storer and the index,
+// call it before NewRouter
+func (s *SPusher) SetMetrics(metrics Metrics) {
+	s.metrics = metrics
+	s.storer = metricStorer{storer: s.storer, metrics: metrics}
+	s.index = metricIndex{bleveIndex: s.index, metrics: metrics}
+}
+
+func (s SPusher) hasMetrics() bool {
+	_, nop := s.metrics.(nopMetrics)
+	return !nop
+}
+
+// Stats the pusher count of the storer and the document count of the index
+func (s SPusher) Stats() (pushers uint64, docs uint64, err error) {
+	if pushers, err = countPushers(s.storer); err != nil {
+		return
+	}
+	docs, err = s.index.DocCount()
+	return
+}
+
+// countPushers count by the optional Counter, otherwise by GetAll which walk every pusher
+func countPushers(storer Storer) (uint64, error) {
+	if c, ok := storer.(Counter); ok {
+		return c.Count()
+	}
+	total, _, err := storer.GetAll(0, 0)
+	return total, err
+}
+
+// statusWriter record the status of the response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// instrument observe the requests by the route template
+func (s SPusher) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var start = time.Now()
+		var sw = &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, req)
+		var route = req.URL.Path
+		if r := mux.CurrentRoute(req); r != nil {
+			if tpl, err := r.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		s.metrics.ObserveRequest(route, req.Method, sw.status, time.Since(start))
+	})
+}
+
+// metricStorer observe the operations of the storer, keep the optional interfaces
+type metricStorer struct {
+	storer  Storer
+	metrics Metrics
+}
+
+func (ms metricStorer) Set(p Pusher) error {
+	var start = time.Now()
+	err := ms.storer.Set(p)
+	ms.metrics.ObserveStorer("set", time.Since(start), err)
+	return err
+}
+
+func (ms metricStorer) Get(id string) (Pusher, error) {
+	var start = time.Now()
+	p, err := ms.storer.Get(id)
+	ms.metrics.ObserveStorer("get", time.Since(start), err)
+	return p, err
+}
+
+func (ms metricStorer) Del(id string) error {
+	var start = time.Now()
+	err := ms.storer.Del(id)
+	ms.metrics.ObserveStorer("del", time.Since(start), err)
+	return err
+}
+
+func (ms metricStorer) GetAll(from, size int) (uint64, []Pusher, error) {
+	var start = time.Now()
+	total, pushers, err := ms.storer.GetAll(from, size)
+	ms.metrics.ObserveStorer("get_all", time.Since(start), err)
+	return total, pushers, err
+}
+
+func (ms metricStorer) SetBatch(ps []Pusher) (err error) {
+	var start = time.Now()
+	if bs, ok := ms.storer.(BatchStorer); ok {
+		err = bs.SetBatch(ps)
+	} else {
+		for _, p := range ps {
+			if err = ms.storer.Set(p); err != nil {
+				break
+			}
+		}
+	}
+	ms.metrics.ObserveStorer("set_batch", time.Since(start), err)
+	return
+}
+
+// Count is not observed, it is called by the metrics scrape
+func (ms metricStorer) Count() (uint64, error) {
+	return countPushers(ms.storer)
+}
+
+func (ms metricStorer) Ping() error {
+	return pingStorer(ms.storer)
+}
+
+func (ms metricStorer) Bucket(name string) (Bucket, error) {
+	return openBucket(ms.storer, name)
+}
+
+func (ms metricStorer) Tenant(name string) (Storer, error) {
+	ts, ok := ms.storer.(TenantStorer)
+	if !ok {
+		return nil, ErrTenantNotSupported
+	}
+	storer, err := ts.Tenant(name)
+	if err != nil {
+		return nil, err
+	}
+	return metricStorer{storer: storer, metrics: ms.metrics}, nil
+}
+
+// bleveIndex the alias to embed bleve.Index into metricIndex, which override the Index method
+type bleveIndex = bleve.Index
+
+// metricIndex observe the operations of the bleve index
+type metricIndex struct {
+	bleveIndex
+	metrics Metrics
+}
+
+func (mi metricIndex) Index(id string, data interface{}) error {
+	var start = time.Now()
+	err := mi.bleveIndex.Index(id, data)
+	mi.metrics.ObserveIndex("index", time.Since(start), err)
+	return err
+}
+
+func (mi metricIndex) Delete(id string) error {
+	var start = time.Now()
+	err := mi.bleveIndex.Delete(id)
+	mi.metrics.ObserveIndex("delete", time.Since(start), err)
+	return err
+}
+
+func (mi metricIndex) Search(req *bleve.SearchRequest) (*bleve.SearchResult, error) {
+	var start = time.Now()
+	ret, err := mi.bleveIndex.Search(req)
+	mi.metrics.ObserveIndex("search", time.Since(start), err)
+	return ret, err
+}
+
+func (mi metricIndex) Batch(b *bleve.Batch) error {
+	var start = time.Now()
+	err := mi.bleveIndex.Batch(b)
+	mi.metrics.ObserveIndex("batch", time.Since(start), err)
+	return err
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"github.com/Lupino/pusher"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Prometheus collect the pusher server metrics with prometheus
+type Prometheus struct {
+	namespace    string
+	registerer   prometheus.Registerer
+	requests     *prometheus.CounterVec
+	latency      *prometheus.HistogramVec
+	submits      *prometheus.CounterVec
+	submitErrors *prometheus.CounterVec
+	storer       *prometheus.HistogramVec
+	storerErrors *prometheus.CounterVec
+	index        *prometheus.HistogramVec
+	indexErrors  *prometheus.CounterVec
+}
+
+// NewPrometheus create the prometheus metrics in a new registry with the go and process collectors
+func NewPrometheus(namespace string) *Prometheus {
+	p, err := NewPrometheusWith(namespace, newRegistry())
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// NewPrometheusWith create the prometheus metrics on the registerer, eg: prometheus.DefaultRegisterer,
+// the servers of a process with the same namespace share the metrics on the registerer
+func NewPrometheusWith(namespace string, reg prometheus.Registerer) (p *Prometheus, err error) {
+	p = &Prometheus{namespace: namespace, registerer: reg}
+	if p.requests, err = registerCounterVec(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "The http requests by route, method and status.",
+	}, []string{"route", "method", "status"})); err != nil {
+		return nil, err
+	}
+	if p.latency, err = registerHistogramVec(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "The http request latencies by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})); err != nil {
+		return nil, err
+	}
+	if p.submits, err = registerCounterVec(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "submits_total",
+		Help:      "The push and pushall jobs submitted to periodic by sender.",
+	}, []string{"kind", "sender"})); err != nil {
+		return nil, err
+	}
+	if p.submitErrors, err = registerCounterVec(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "submit_errors_total",
+		Help:      "The push and pushall jobs failed to submit to periodic by sender.",
+	}, []string{"kind", "sender"})); err != nil {
+		return nil, err
+	}
+	if p.storer, err = registerHistogramVec(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "storer_duration_seconds",
+		Help:      "The storer operation latencies.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})); err != nil {
+		return nil, err
+	}
+	if p.storerErrors, err = registerCounterVec(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "storer_errors_total",
+		Help:      "The storer operation errors.",
+	}, []string{"op"})); err != nil {
+		return nil, err
+	}
+	if p.index, err = registerHistogramVec(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "index_duration_seconds",
+		Help:      "The bleve index operation latencies.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"op"})); err != nil {
+		return nil, err
+	}
+	if p.indexErrors, err = registerCounterVec(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "index_errors_total",
+		Help:      "The bleve index operation errors.",
+	}, []string{"op"})); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Handler serve the metrics of the registerer, see NewPrometheusWith
+func (p *Prometheus) Handler() http.Handler {
+	return handler(p.registerer)
+}
+
+// WatchServer collect the pusher total and the index document count of the server on every scrape,
+// return an error if a server is already watched on the registerer
+func (p *Prometheus) WatchServer(sp pusher.SPusher) error {
+	return p.registerer.Register(serverCollector{
+		sp:      sp,
+		pushers: prometheus.NewDesc(prometheus.BuildFQName(p.namespace, "", "pushers"), "The pushers in the storer.", nil, nil),
+		docs:    prometheus.NewDesc(prometheus.BuildFQName(p.namespace, "", "index_documents"), "The documents in the bleve index.", nil, nil),
+	})
+}
+
+// serverCollector call the server Stats once per scrape for both gauges
+type serverCollector struct {
+	sp      pusher.SPusher
+	pushers *prometheus.Desc
+	docs    *prometheus.Desc
+}
+
+func (c serverCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.pushers
+	ch <- c.docs
+}
+
+func (c serverCollector) Collect(ch chan<- prometheus.Metric) {
+	pushers, docs, err := c.sp.Stats()
+	if err != nil {
+		// skip the gauges, not fail the other metrics of the scrape
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.pushers, prometheus.GaugeValue, float64(pushers))
+	ch <- prometheus.MustNewConstMetric(c.docs, prometheus.GaugeValue, float64(docs))
+}
+
+// ObserveRequest a request of the route template
+func (p *Prometheus) ObserveRequest(route, method string, status int, elapsed time.Duration) {
+	p.requests.WithLabelValues(route, method, strconv.Itoa(status)).Inc()
+	p.latency.WithLabelValues(route, method).Observe(elapsed.Seconds())
+}
+
+// IncSubmit count a job submitted to periodic
+func (p *Prometheus) IncSubmit(kind, sender string) {
+	p.submits.WithLabelValues(kind, sender).Inc()
+}
+
+// IncSubmitError count a job failed to submit to periodic
+func (p *Prometheus) IncSubmitError(kind, sender string) {
+	p.submitErrors.WithLabelValues(kind, sender).Inc()
+}
+
+// ObserveStorer an operation of the storer
+func (p *Prometheus) ObserveStorer(op string, elapsed time.Duration, err error) {
+	p.storer.WithLabelValues(op).Observe(elapsed.Seconds())
+	if err != nil {
+		p.storerErrors.WithLabelValues(op).Inc()
+	}
+}
+
+// ObserveIndex an operation of the bleve index
+func (p *Prometheus) ObserveIndex(op string, elapsed time.Duration, err error) {
+	p.index.WithLabelValues(op).Observe(elapsed.Seconds())
+	if err != nil {
+		p.indexErrors.WithLabelValues(op).Inc()
+	}
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+// register the collector on the registerer, return the collector already registered with the same metrics,
+// eg: by another worker of the process, so they count together
+func register(reg prometheus.Registerer, c prometheus.Collector) (prometheus.Collector, error) {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector, nil
+		}
+		return nil, err
+	}
+	return c, nil
+}
+
+func registerCounterVec(reg prometheus.Registerer, vec *prometheus.CounterVec) (*prometheus.CounterVec, error) {
+	c, err := register(reg, vec)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := c.(*prometheus.CounterVec); ok {
+		return existing, nil
+	}
+	return vec, nil
+}
+
+func registerHistogramVec(reg prometheus.Registerer, vec *prometheus.HistogramVec) (*prometheus.HistogramVec, error) {
+	c, err := register(reg, vec)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := c.(*prometheus.HistogramVec); ok {
+		return existing, nil
+	}
+	return vec, nil
+}
+
+func registerGaugeVec(reg prometheus.Registerer, vec *prometheus.GaugeVec) (*prometheus.GaugeVec, error) {
+	c, err := register(reg, vec)
+	if err != nil {
+		return nil, err
+	}
+	if existing, ok := c.(*prometheus.GaugeVec); ok {
+		return existing, nil
+	}
+	return vec, nil
+}
+
+// newRegistry create a registry with the go and process collectors
+func newRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// handler serve the metrics of the registerer if it is a gatherer, eg: a *prometheus.Registry,
+// otherwise the prometheus.DefaultGatherer
+func handler(reg prometheus.Registerer) http.Handler {
+	if gatherer, ok := reg.(prometheus.Gatherer); ok {
+		return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	}
+	return promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{})
+}
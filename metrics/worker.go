@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"time"
+)
+
+// WorkerPrometheus collect the pusher worker metrics with prometheus
+type WorkerPrometheus struct {
+	registerer prometheus.Registerer
+	jobs       *prometheus.CounterVec
+	latency    *prometheus.HistogramVec
+	errors     *prometheus.CounterVec
+	inflight   *prometheus.GaugeVec
+}
+
+// NewWorkerPrometheus create the prometheus worker metrics in a new registry with the go and process collectors
+func NewWorkerPrometheus(namespace string) *WorkerPrometheus {
+	p, err := NewWorkerPrometheusWith(namespace, newRegistry())
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// NewWorkerPrometheusWith create the prometheus worker metrics on the registerer, eg: prometheus.DefaultRegisterer,
+// the workers of a process with the same namespace share the metrics on the registerer
+func NewWorkerPrometheusWith(namespace string, reg prometheus.Registerer) (p *WorkerPrometheus, err error) {
+	p = &WorkerPrometheus{registerer: reg}
+	if p.jobs, err = registerCounterVec(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_total",
+		Help:      "The jobs by sender and result, eg: sent, retry, failed, invalid, expired and dead.",
+	}, []string{"sender", "result"})); err != nil {
+		return nil, err
+	}
+	if p.latency, err = registerHistogramVec(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "send_duration_seconds",
+		Help:      "The send latencies by sender.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"sender"})); err != nil {
+		return nil, err
+	}
+	if p.errors, err = registerCounterVec(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "send_errors_total",
+		Help:      "The send errors by sender.",
+	}, []string{"sender"})); err != nil {
+		return nil, err
+	}
+	if p.inflight, err = registerGaugeVec(reg, prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "sends_in_flight",
+		Help:      "The in-flight sends by sender.",
+	}, []string{"sender"})); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Handler serve the metrics of the registerer, see NewWorkerPrometheusWith
+func (p *WorkerPrometheus) Handler() http.Handler {
+	return handler(p.registerer)
+}
+
+// IncJob count a job result of the sender
+func (p *WorkerPrometheus) IncJob(sender, result string) {
+	p.jobs.WithLabelValues(sender, result).Inc()
+}
+
+// ObserveSend a send of the sender
+func (p *WorkerPrometheus) ObserveSend(sender string, elapsed time.Duration, err error) {
+	p.latency.WithLabelValues(sender).Observe(elapsed.Seconds())
+	if err != nil {
+		p.errors.WithLabelValues(sender).Inc()
+	}
+}
+
+// AddInflight add the delta to the in-flight sends of the sender
+func (p *WorkerPrometheus) AddInflight(sender string, delta int) {
+	p.inflight.WithLabelValues(sender).Add(float64(delta))
+}
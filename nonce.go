@@ -0,0 +1,64 @@
+package pusher
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// the request time window, also the time a nonce keep in the replay cache
+const requestWindow = 10 * time.Minute
+
+const maxNonces = 100000
+
+type nonceEntry struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// nonceCache a bounded replay cache of the request nonces
+type nonceCache struct {
+	locker  sync.Mutex
+	nonces  map[string]*list.Element
+	entries *list.List
+	size    int
+}
+
+func newNonceCache(size int) *nonceCache {
+	return &nonceCache{
+		nonces:  make(map[string]*list.Element),
+		entries: list.New(),
+		size:    size,
+	}
+}
+
+// use a nonce, return false if the nonce is used in the time window.
+// The nonce is never forgotten in the time window, when the cache is full of the
+// nonces in the time window, return false with the wait until the oldest expires.
+func (c *nonceCache) use(nonce string) (bool, time.Duration) {
+	return c.useAt(nonce, time.Now())
+}
+
+func (c *nonceCache) useAt(nonce string, now time.Time) (bool, time.Duration) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	// the entries is ordered by expiresAt, remove the expired from the front
+	for e := c.entries.Front(); e != nil; e = c.entries.Front() {
+		entry := e.Value.(nonceEntry)
+		if entry.expiresAt.After(now) {
+			break
+		}
+		c.entries.Remove(e)
+		delete(c.nonces, entry.nonce)
+	}
+	if _, ok := c.nonces[nonce]; ok {
+		return false, 0
+	}
+	if c.entries.Len() >= c.size {
+		return false, c.entries.Front().Value.(nonceEntry).expiresAt.Sub(now)
+	}
+	// a request is valid in the window before and after now
+	entry := nonceEntry{nonce: nonce, expiresAt: now.Add(2 * requestWindow)}
+	c.nonces[nonce] = c.entries.PushBack(entry)
+	return true, 0
+}
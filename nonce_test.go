@@ -0,0 +1,46 @@
+package pusher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNonceCacheReplay(t *testing.T) {
+	var c = newNonceCache(10)
+	var now = time.Now()
+	if ok, _ := c.useAt("a", now); !ok {
+		t.Fatal("the first use of a nonce should be allowed")
+	}
+	if ok, wait := c.useAt("a", now.Add(time.Minute)); ok || wait != 0 {
+		t.Fatalf("the replayed nonce should be rejected, got %v %v", ok, wait)
+	}
+	if ok, _ := c.useAt("a", now.Add(2*requestWindow)); !ok {
+		t.Fatal("the nonce should be allowed after it expired")
+	}
+}
+
+func TestNonceCacheFull(t *testing.T) {
+	var c = newNonceCache(2)
+	var now = time.Now()
+	c.useAt("a", now)
+	c.useAt("b", now.Add(time.Second))
+
+	ok, wait := c.useAt("c", now.Add(time.Minute))
+	if ok {
+		t.Fatal("the nonce should be rejected when the cache is full")
+	}
+	if want := 2*requestWindow - time.Minute; wait != want {
+		t.Fatalf("wait %v, want %v", wait, want)
+	}
+	// the live nonces are never evicted by the flood
+	if ok, wait := c.useAt("a", now.Add(time.Minute)); ok || wait != 0 {
+		t.Fatalf("the replayed nonce should be rejected, got %v %v", ok, wait)
+	}
+
+	if ok, _ := c.useAt("c", now.Add(2*requestWindow)); !ok {
+		t.Fatal("the nonce should be allowed after the oldest expired")
+	}
+	if ok, _ := c.useAt("b", now.Add(2*requestWindow)); ok {
+		t.Fatal("the replayed nonce should be rejected")
+	}
+}
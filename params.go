@@ -0,0 +1,104 @@
+package pusher
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// requestParams the request params from an url encoded form or a json body
+type requestParams struct {
+	form url.Values
+	json map[string]json.RawMessage
+}
+
+func isJSONRequest(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// readBody read the request body and put it back, so the body can read again
+func readBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil {
+		return nil, nil
+	}
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, err
+}
+
+// readParams read the request params, a json body must be an object
+func readParams(req *http.Request) (params requestParams, err error) {
+	if !isJSONRequest(req) {
+		err = req.ParseForm()
+		params.form = req.Form
+		return
+	}
+	var body []byte
+	if body, err = readBody(req); err != nil {
+		return
+	}
+	params.form = req.URL.Query()
+	if len(bytes.TrimSpace(body)) == 0 {
+		return
+	}
+	err = json.Unmarshal(body, &params.json)
+	return
+}
+
+// Has the param
+func (p requestParams) Has(key string) bool {
+	if _, ok := p.json[key]; ok {
+		return true
+	}
+	_, ok := p.form[key]
+	return ok
+}
+
+// Get a param as string, a json string is unquoted,
+// the other json value is the compact json text, eg: the push data object
+func (p requestParams) Get(key string) string {
+	raw, ok := p.json[key]
+	if !ok {
+		return p.form.Get(key)
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return str
+	}
+	if string(raw) == "null" {
+		return ""
+	}
+	var buffer = bytes.NewBuffer(nil)
+	if err := json.Compact(buffer, raw); err != nil {
+		return string(raw)
+	}
+	return buffer.String()
+}
+
+// Bool get a param as bool
+func (p requestParams) Bool(key string) bool {
+	v, _ := strconv.ParseBool(p.Get(key))
+	return v
+}
+
+// Strings get a param as string list, a json array or a repeated form param
+func (p requestParams) Strings(key string) []string {
+	raw, ok := p.json[key]
+	if !ok {
+		return p.form[key]
+	}
+	var strs []string
+	if err := json.Unmarshal(raw, &strs); err == nil {
+		return strs
+	}
+	if str := p.Get(key); str != "" {
+		return []string{str}
+	}
+	return nil
+}
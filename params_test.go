@@ -0,0 +1,75 @@
+package pusher
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadParams(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		body        string
+		key         string
+		has         bool
+		get         string
+		strs        []string
+	}{
+		{"form", "application/x-www-form-urlencoded", "pusher=4711&tag=a&tag=b", "pusher", true, "4711", []string{"4711"}},
+		{"form repeated", "application/x-www-form-urlencoded", "tag=a&tag=b", "tag", true, "a", []string{"a", "b"}},
+		{"form missing", "application/x-www-form-urlencoded", "pusher=4711", "tag", false, "", nil},
+		{"json string", "application/json", `{"pusher": "4711"}`, "pusher", true, "4711", []string{"4711"}},
+		{"json number", "application/json", `{"createdAt": 1456403493}`, "createdAt", true, "1456403493", []string{"1456403493"}},
+		{"json object", "application/json", `{"data": {"subject": "hi", "text": "hello"}}`, "data", true, `{"subject":"hi","text":"hello"}`, []string{`{"subject":"hi","text":"hello"}`}},
+		{"json array", "application/json", `{"tag": ["a", "b"]}`, "tag", true, `["a","b"]`, []string{"a", "b"}},
+		{"json null", "application/json; charset=utf-8", `{"tag": null}`, "tag", true, "", nil},
+		{"json empty", "application/json", "", "pusher", false, "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/pusher/pushers/", strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			params, err := readParams(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if params.Has(test.key) != test.has {
+				t.Errorf("Has(%s) = %v, want %v", test.key, !test.has, test.has)
+			}
+			if got := params.Get(test.key); got != test.get {
+				t.Errorf("Get(%s) = %s, want %s", test.key, got, test.get)
+			}
+			if got := params.Strings(test.key); !reflect.DeepEqual(got, test.strs) {
+				t.Errorf("Strings(%s) = %v, want %v", test.key, got, test.strs)
+			}
+		})
+	}
+}
+
+func TestReadParamsQuery(t *testing.T) {
+	req := httptest.NewRequest("POST", "/pusher/pushers/?force=true", strings.NewReader(`{"pusher": "4711"}`))
+	req.Header.Set("Content-Type", "application/json")
+	params, err := readParams(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !params.Bool("force") || params.Get("pusher") != "4711" {
+		t.Fatal("the json body should be read with the url query")
+	}
+	// the body can be read again, eg: to verify the signature
+	if body, _ := readBody(req); string(body) != `{"pusher": "4711"}` {
+		t.Fatalf("the body should be put back, got %s", body)
+	}
+}
+
+func TestReadParamsInvalid(t *testing.T) {
+	for _, body := range []string{`["4711"]`, `{"pusher": `, `"4711"`} {
+		req := httptest.NewRequest("POST", "/pusher/pushers/", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if _, err := readParams(req); err == nil {
+			t.Errorf("the json body %s should be rejected", body)
+		}
+	}
+}
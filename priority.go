@@ -0,0 +1,39 @@
+package pusher
+
+// message priority
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// Priorities all the message priorities, from high to low
+var Priorities = []string{PriorityHigh, PriorityNormal, PriorityLow}
+
+// ValidPriority check the priority, the empty priority is normal
+func ValidPriority(priority string) bool {
+	switch priority {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// TenantPrefix the periodic func prefix of a tenant, eg: pusher:shop:,
+// the default tenant use the prefix as it is
+func TenantPrefix(prefix, tenant string) string {
+	if tenant == "" {
+		return prefix
+	}
+	return prefix + tenant + ":"
+}
+
+// FuncName the periodic func name of a sender with the priority,
+// the normal priority is prefix+sender, the others is prefix+sender+":"+priority,
+// eg: pusher:sendmail:high
+func FuncName(prefix, sender, priority string) string {
+	if priority == "" || priority == PriorityNormal {
+		return prefix + sender
+	}
+	return prefix + sender + ":" + priority
+}
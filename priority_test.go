@@ -0,0 +1,21 @@
+package pusher
+
+import "testing"
+
+func TestFuncName(t *testing.T) {
+	var tests = []struct {
+		tenant, sender, priority string
+		want                     string
+	}{
+		{"", "sendmail", "", "pusher:sendmail"},
+		{"", "sendmail", PriorityNormal, "pusher:sendmail"},
+		{"", "sendmail", PriorityHigh, "pusher:sendmail:high"},
+		{"shop", "sendmail", "", "pusher:shop:sendmail"},
+		{"shop", "pushall", PriorityLow, "pusher:shop:pushall:low"},
+	}
+	for _, test := range tests {
+		if got := FuncName(TenantPrefix(PREFIX, test.tenant), test.sender, test.priority); got != test.want {
+			t.Errorf("FuncName(%q, %q, %q) = %s, want %s", test.tenant, test.sender, test.priority, got, test.want)
+		}
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"github.com/Lupino/go-periodic"
 	"github.com/Lupino/pusher/utils"
 	"github.com/blevesearch/bleve"
-	"log"
+	"log/slog"
+	"strings"
+	"time"
 )
 
 // PREFIX the default perfix key of pusher.
@@ -20,6 +22,8 @@ type Pusher struct {
 	Senders     []string `json:"senders"`
 	Tags        []string `json:"tags"`
 	CreatedAt   int64    `json:"createdAt"`
+	// UpdatedAt the unix time in nanoseconds the pusher is saved, the version of the pusher
+	UpdatedAt int64 `json:"updatedAt,omitempty"`
 }
 
 // NewPusher create a pusher from json bytes
@@ -28,12 +32,42 @@ func NewPusher(payload []byte) (pusher Pusher, err error) {
 	return
 }
 
+// ValidPusherID check the pusher id, the id can not contain "/",
+// which qualify the pusher with the tenant in the job name, see utils.JoinTenant
+func ValidPusherID(id string) bool {
+	return id != "" && !strings.Contains(id, "/")
+}
+
 // Bytes encode pusher to json bytes
 func (pusher Pusher) Bytes() (data []byte) {
 	data, _ = json.Marshal(pusher)
 	return
 }
 
+// Field return the pusher field by the json name, eg: email, empty if the field is unknown
+func (pusher Pusher) Field(name string) string {
+	switch name {
+	case "id":
+		return pusher.ID
+	case "email":
+		return pusher.Email
+	case "nickname":
+		return pusher.NickName
+	case "phoneNumber":
+		return pusher.PhoneNumber
+	}
+	return ""
+}
+
+// KnownField the pusher field can be required by a sender
+func KnownField(name string) bool {
+	switch name {
+	case "id", "email", "nickname", "phoneNumber":
+		return true
+	}
+	return false
+}
+
 // HasSender on a pusher
 func (pusher Pusher) HasSender(sender string) bool {
 	for _, s := range pusher.Senders {
@@ -104,28 +138,119 @@ func (pusher *Pusher) DelTag(sender string) bool {
 	return true
 }
 
+// periodicClient the methods of *periodic.Client used by the server
+type periodicClient interface {
+	SubmitJob(funcName, name string, opts map[string]string) error
+	RemoveJob(funcName, name string) error
+	Ping() bool
+}
+
 // SPusher server pusher
 type SPusher struct {
-	storer Storer
-	p      *periodic.Client
-	key    string
-	secret string
-	path   string
-	prefix string
-	index  bleve.Index
+	storer  Storer
+	p       periodicClient
+	key     string
+	secret  string
+	path    string
+	prefix  string
+	index   bleve.Index
+	bulk    *bulkJobs
+	senders *senderRegistry
+	keys    *keyStore
+	tenant  string
+	tenants *tenantSet
+	limiter *rateLimiter
+	quotas  *quotaStore
+	caps    *capCounters
+	status  *deliveryStore
+	letters *deadLetterStore
+	changes *changeLog
+
+	legacyAuth bool
+	nonces     *nonceCache
+	snapshot   bool
+	metrics    Metrics
+	logger     *slog.Logger
 }
 
 // NewSPusher create a server pusher instance
 func NewSPusher(storer Storer, p *periodic.Client, path string) (sp SPusher, err error) {
-	var index bleve.Index
-	if index, err = openIndex(path); err != nil {
+	var (
+		index  bleve.Index
+		bucket Bucket
+		// the delivery store start the expire goroutine, open it the last
+		statusBucket Bucket
+		senders      *senderRegistry
+		keys         *keyStore
+		quotas       *quotaStore
+		caps         *capCounters
+	)
+	if index, err = openIndex(path, storer); err != nil {
+		return
+	}
+	if bucket, err = openBucket(storer, "senders"); err != nil {
+		return
+	}
+	if senders, err = newSenderRegistry(bucket); err != nil {
+		return
+	}
+	if bucket, err = openBucket(storer, "keys"); err != nil {
+		return
+	}
+	if keys, err = newKeyStore(bucket); err != nil {
+		return
+	}
+	if bucket, err = openBucket(storer, "quotas"); err != nil {
+		return
+	}
+	if quotas, err = newQuotaStore(bucket); err != nil {
+		return
+	}
+	if bucket, err = openBucket(storer, "caps"); err != nil {
+		return
+	}
+	if caps, err = newCapCounters(bucket); err != nil {
 		return
 	}
-	sp = SPusher{storer: storer, p: p, path: path, index: index, prefix: PREFIX}
+	if statusBucket, err = openBucket(storer, "deliveries"); err != nil {
+		return
+	}
+	if bucket, err = openBucket(storer, "deadletters"); err != nil {
+		return
+	}
+	sp = SPusher{
+		storer:  storer,
+		p:       p,
+		path:    path,
+		index:   index,
+		prefix:  PREFIX,
+		bulk:    newBulkJobs(),
+		senders: senders,
+		keys:    keys,
+		tenants: newTenantSet(),
+		limiter: newRateLimiter(),
+		quotas:  quotas,
+		caps:    caps,
+		status:  newDeliveryStore(statusBucket),
+		letters: newDeadLetterStore(bucket),
+		changes: newChangeLog(),
+		nonces:  newNonceCache(maxNonces),
+		metrics: nopMetrics{},
+		logger:  slog.Default(),
+	}
 	return
 }
 
-// SetKey server pusher app key
+// Close the indexes of the server pusher and its tenants, stop the background goroutines, eg: the delivery status expire
+func (s SPusher) Close() {
+	s.status.close()
+	s.tenants.close()
+	if err := s.index.Close(); err != nil {
+		s.logger.Error("bleve.Index.Close() failed", "err", err)
+	}
+}
+
+// SetKey server pusher app key, the root key has the admin scope
 func (s *SPusher) SetKey(key string) {
 	s.key = key
 }
@@ -135,11 +260,33 @@ func (s *SPusher) SetSecret(secret string) {
 	s.secret = secret
 }
 
+// SetLegacyAuth accept the legacy HmacMD5 signature without nonce
+func (s *SPusher) SetLegacyAuth(legacy bool) {
+	s.legacyAuth = legacy
+}
+
+// SetRateLimit set the default rate limit of the api keys on a route class,
+// the route class is the scope of the route, a zero rate is unlimited
+func (s *SPusher) SetRateLimit(class string, rate float64, burst int) {
+	s.limiter.setLimit(class, RateLimit{Rate: rate, Burst: burst})
+}
+
+// SetSnapshot embed the pusher snapshot into the push job,
+// so the sender can skip the pusher lookup
+func (s *SPusher) SetSnapshot(snapshot bool) {
+	s.snapshot = snapshot
+}
+
 // SetPrefix set prefix key for periodic
 func (s *SPusher) SetPrefix(prefix string) {
 	s.prefix = prefix
 }
 
+// funcPrefix the periodic func prefix of the tenant
+func (s SPusher) funcPrefix() string {
+	return TenantPrefix(s.prefix, s.tenant)
+}
+
 func (s SPusher) addSender(p Pusher, senders ...string) (err error) {
 	changed := false
 	for _, sender := range senders {
@@ -204,36 +351,78 @@ func (s SPusher) removeTag(p Pusher, tags ...string) (err error) {
 	return
 }
 
-func (s SPusher) push(sender, pusher, data, schedat string) (string, error) {
+// push submit the job of the payload
+func (s SPusher) push(sender, pusher string, payload utils.Payload, schedat, priority string) (string, error) {
 	var opts = map[string]string{
-		"args":    data,
+		"args":    utils.EncodePayload(payload),
 		"schedat": schedat,
 	}
-	var name = utils.GenerateName(pusher, data)
-	if err := s.p.SubmitJob(s.prefix+sender, name, opts); err != nil {
+	var name = utils.GeneratePayloadName(utils.JoinTenant(s.tenant, pusher), payload)
+	if err := s.p.SubmitJob(FuncName(s.funcPrefix(), sender, priority), name, opts); err != nil {
+		s.metrics.IncSubmitError("push", sender)
 		return "", err
 	}
+	s.metrics.IncSubmit("push", sender)
 	return name, nil
 }
 
-func (s SPusher) pushAll(sender, data, schedat string) (string, error) {
+func (s SPusher) pushAll(sender string, payload utils.Payload, schedat, priority string) (string, error) {
 	var opts = map[string]string{
-		"args":    data,
+		"args":    utils.EncodePayload(payload),
 		"schedat": schedat,
 	}
-	var name = utils.GenerateName(sender, data)
-	if err := s.p.SubmitJob(s.prefix+"pushall", name, opts); err != nil {
+	var name = utils.GeneratePayloadName(utils.JoinTenant(s.tenant, sender), payload)
+	if err := s.p.SubmitJob(FuncName(s.funcPrefix(), "pushall", priority), name, opts); err != nil {
+		s.metrics.IncSubmitError("pushall", sender)
 		return "", err
 	}
+	s.metrics.IncSubmit("pushall", sender)
 	return name, nil
 }
 
 func (s SPusher) savePusher(p Pusher) (err error) {
+	p.UpdatedAt = time.Now().UnixNano()
 	if err = s.storer.Set(p); err != nil {
 		return
 	}
+	s.changes.add(utils.JoinTenant(s.tenant, p.ID))
 	if err = s.index.Index(p.ID, p); err != nil {
-		log.Printf("bleve.Index.Index() failed(%s)", err)
+		s.logger.Error("bleve.Index.Index() failed", "err", err)
+	}
+	return nil
+}
+
+// savePushers save many pushers in one transaction if the storer is a BatchStorer
+func (s SPusher) savePushers(ps []Pusher) (err error) {
+	if len(ps) == 0 {
+		return nil
+	}
+	var now = time.Now().UnixNano()
+	for i := range ps {
+		ps[i].UpdatedAt = now
+	}
+	if bs, ok := s.storer.(BatchStorer); ok {
+		err = bs.SetBatch(ps)
+	} else {
+		for _, p := range ps {
+			if err = s.storer.Set(p); err != nil {
+				break
+			}
+		}
+	}
+	// the pushers may be saved partly
+	for _, p := range ps {
+		s.changes.add(utils.JoinTenant(s.tenant, p.ID))
+	}
+	if err != nil {
+		return
+	}
+	batch := s.index.NewBatch()
+	for _, p := range ps {
+		batch.Index(p.ID, p)
+	}
+	if err = s.index.Batch(batch); err != nil {
+		s.logger.Error("bleve.Index.Batch() failed", "err", err)
 	}
 	return nil
 }
@@ -242,8 +431,9 @@ func (s SPusher) removePusher(p string) (err error) {
 	if err = s.storer.Del(p); err != nil {
 		return
 	}
+	s.changes.add(utils.JoinTenant(s.tenant, p))
 	if err = s.index.Delete(p); err != nil {
-		log.Printf("bleve.Index.Delete() failed(%s)", err)
+		s.logger.Error("bleve.Index.Delete() failed", "err", err)
 	}
 	return nil
 }
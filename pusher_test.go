@@ -0,0 +1,213 @@
+package pusher
+
+import (
+	"github.com/Lupino/pusher/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memStorer a Storer in memory with tenants
+type memStorer struct {
+	locker  sync.Mutex
+	pushers map[string]Pusher
+	tenants map[string]*memStorer
+}
+
+func newMemStorer() *memStorer {
+	return &memStorer{pushers: make(map[string]Pusher), tenants: make(map[string]*memStorer)}
+}
+
+func (m *memStorer) Set(p Pusher) error {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	m.pushers[p.ID] = p
+	return nil
+}
+
+func (m *memStorer) Get(id string) (Pusher, error) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	return m.pushers[id], nil
+}
+
+func (m *memStorer) Del(id string) error {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	delete(m.pushers, id)
+	return nil
+}
+
+func (m *memStorer) GetAll(from, size int) (uint64, []Pusher, error) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	var ids []string
+	for id := range m.pushers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	var pushers []Pusher
+	for i := from; i < len(ids) && i < from+size; i++ {
+		pushers = append(pushers, m.pushers[ids[i]])
+	}
+	return uint64(len(ids)), pushers, nil
+}
+
+func (m *memStorer) Tenant(name string) (Storer, error) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+	if _, ok := m.tenants[name]; !ok {
+		m.tenants[name] = newMemStorer()
+	}
+	return m.tenants[name], nil
+}
+
+// testJob a job submitted to testPeriodic
+type testJob struct {
+	Func string
+	Name string
+	Opts map[string]string
+}
+
+// testPeriodic record the submitted jobs, fail the submit when err is set
+type testPeriodic struct {
+	locker sync.Mutex
+	jobs   []testJob
+	err    error
+}
+
+func (p *testPeriodic) SubmitJob(funcName, name string, opts map[string]string) error {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+	p.jobs = append(p.jobs, testJob{Func: funcName, Name: name, Opts: opts})
+	return nil
+}
+
+func (p *testPeriodic) RemoveJob(funcName, name string) error {
+	return nil
+}
+
+func (p *testPeriodic) Ping() bool {
+	return true
+}
+
+func (p *testPeriodic) submitted() []testJob {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+	return append([]testJob(nil), p.jobs...)
+}
+
+// newTestSPusher create a server pusher on a memory storer and a test periodic
+func newTestSPusher(t *testing.T) (SPusher, *testPeriodic) {
+	sp, err := NewSPusher(newMemStorer(), nil, filepath.Join(t.TempDir(), "index"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(sp.Close)
+	var p = &testPeriodic{}
+	sp.p = p
+	return sp, p
+}
+
+// postForm create a form request, authed by the api key if it is not empty
+func postForm(path string, form url.Values, key *APIKey) *http.Request {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if key != nil {
+		req = withAPIKey(req, *key)
+	}
+	return req
+}
+
+func TestValidPusherID(t *testing.T) {
+	var tests = []struct {
+		id    string
+		valid bool
+	}{
+		{"4711", true},
+		{"lupino@example.com", true},
+		{"", false},
+		{"acme/4711", false},
+		{"/4711", false},
+	}
+	for _, test := range tests {
+		if got := ValidPusherID(test.id); got != test.valid {
+			t.Errorf("ValidPusherID(%q) = %v, want %v", test.id, got, test.valid)
+		}
+	}
+}
+
+// a pusher of the default tenant named tenant/id would be split to the tenant by the worker
+func TestPusherCannotReachTenant(t *testing.T) {
+	sp, p := newTestSPusher(t)
+	sp.senders.announce(SenderInfo{Name: "sendmail"}, "worker")
+
+	var rec = httptest.NewRecorder()
+	sp.handleAddPusher(rec, postForm("/pusher/pushers/", url.Values{
+		"pusher":  {"acme/4711"},
+		"senders": {"sendmail"},
+	}, nil))
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("add pusher status %d, want %d", rec.Code, http.StatusNotAcceptable)
+	}
+	if got, _ := sp.storer.Get("acme/4711"); got.ID != "" {
+		t.Fatal("the pusher acme/4711 should not be saved")
+	}
+
+	// a pusher saved by an older server can not be pushed either
+	sp.storer.Set(Pusher{ID: "acme/4711", Senders: []string{"sendmail"}})
+	rec = httptest.NewRecorder()
+	sp.handlePush(rec, postForm("/pusher/sendmail/push", url.Values{
+		"pusher": {"acme/4711"},
+		"data":   {"hello"},
+	}, nil), "sendmail")
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("push status %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if jobs := p.submitted(); len(jobs) != 0 {
+		t.Fatalf("no job should be submitted, got %+v", jobs)
+	}
+
+	rec = httptest.NewRecorder()
+	sp.handleBulk(rec, postForm("/pusher/bulk/tags/vip/add", url.Values{
+		"pusher": {"acme/4711"},
+	}, nil), BulkAddTag, "vip")
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("bulk status %d, want %d", rec.Code, http.StatusNotAcceptable)
+	}
+}
+
+func TestTenantPusherJob(t *testing.T) {
+	sp, p := newTestSPusher(t)
+	acme, err := sp.openTenant("acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = acme.push("sendmail", "4711", utils.Payload{Data: "hello"}, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = sp.push("sendmail", "4711", utils.Payload{Data: "hello"}, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	jobs := p.submitted()
+	if len(jobs) != 2 {
+		t.Fatalf("submitted %d jobs, want 2", len(jobs))
+	}
+	if jobs[0].Func != "pusher:acme:sendmail" || jobs[1].Func != "pusher:sendmail" {
+		t.Errorf("the funcs %s and %s should be namespaced by the tenant", jobs[0].Func, jobs[1].Func)
+	}
+	if !strings.HasPrefix(jobs[0].Name, "acme/4711_") {
+		t.Errorf("the tenant job name %s should be qualified", jobs[0].Name)
+	}
+	if strings.Contains(jobs[1].Name, "/") {
+		t.Errorf("the default tenant job name %s should not be qualified", jobs[1].Name)
+	}
+}
@@ -0,0 +1,168 @@
+package pusher
+
+import (
+	"encoding/json"
+	"github.com/Lupino/pusher/utils"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Quota the daily and monthly send quota of a sender, the counters reset in UTC
+type Quota struct {
+	Sender string `json:"sender"`
+	// Daily the max pushes a day, 0 is unlimited
+	Daily int64 `json:"daily"`
+	// Monthly the max pushes a month, 0 is unlimited
+	Monthly   int64  `json:"monthly"`
+	Day       string `json:"day"`
+	DayUsed   int64  `json:"dayUsed"`
+	Month     string `json:"month"`
+	MonthUsed int64  `json:"monthUsed"`
+}
+
+// reset the counters when a new day or month begin
+func (q *Quota) reset(now time.Time) {
+	if day := now.Format("2006-01-02"); q.Day != day {
+		q.Day = day
+		q.DayUsed = 0
+	}
+	if month := now.Format("2006-01"); q.Month != month {
+		q.Month = month
+		q.MonthUsed = 0
+	}
+}
+
+// exceeded return how long to wait for the quota reset if the quota is exceeded
+func (q Quota) exceeded(now time.Time, n int64) (time.Duration, bool) {
+	if q.Monthly > 0 && q.MonthUsed+n > q.Monthly {
+		next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		return next.Sub(now), true
+	}
+	if q.Daily > 0 && q.DayUsed+n > q.Daily {
+		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		return next.Sub(now), true
+	}
+	return 0, false
+}
+
+// quotaStore the persisted sender quotas of every tenant
+type quotaStore struct {
+	locker sync.Mutex
+	quotas map[string]Quota
+	bucket Bucket
+}
+
+func newQuotaStore(bucket Bucket) (*quotaStore, error) {
+	var qs = &quotaStore{quotas: make(map[string]Quota), bucket: bucket}
+	err := bucket.ForEach(func(key string, value []byte) error {
+		var q Quota
+		if err := json.Unmarshal(value, &q); err != nil {
+			return err
+		}
+		qs.quotas[key] = q
+		return nil
+	})
+	return qs, err
+}
+
+func (qs *quotaStore) save(key string, q Quota) error {
+	data, _ := json.Marshal(q)
+	if err := qs.bucket.Put(key, data); err != nil {
+		return err
+	}
+	qs.quotas[key] = q
+	return nil
+}
+
+// set the sender quota limit, keep the counters
+func (qs *quotaStore) set(tenant, sender string, daily, monthly int64) (Quota, error) {
+	qs.locker.Lock()
+	defer qs.locker.Unlock()
+	var key = utils.JoinTenant(tenant, sender)
+	q := qs.quotas[key]
+	q.Sender = sender
+	q.Daily = daily
+	q.Monthly = monthly
+	q.reset(time.Now().UTC())
+	return q, qs.save(key, q)
+}
+
+func (qs *quotaStore) remove(tenant, sender string) error {
+	qs.locker.Lock()
+	defer qs.locker.Unlock()
+	var key = utils.JoinTenant(tenant, sender)
+	if err := qs.bucket.Delete(key); err != nil {
+		return err
+	}
+	delete(qs.quotas, key)
+	return nil
+}
+
+// use n pushes of the sender quota, the sender without quota is unlimited,
+// use 0 to check there is one push left at least, eg: a pushall, the pushes of it use the quota
+func (qs *quotaStore) use(tenant, sender string, n int64) (time.Duration, bool, error) {
+	qs.locker.Lock()
+	defer qs.locker.Unlock()
+	var key = utils.JoinTenant(tenant, sender)
+	q, ok := qs.quotas[key]
+	if !ok {
+		return 0, true, nil
+	}
+	var now = time.Now().UTC()
+	q.reset(now)
+	var need = n
+	if need == 0 {
+		need = 1
+	}
+	if retry, exceeded := q.exceeded(now, need); exceeded {
+		return retry, false, nil
+	}
+	if n == 0 {
+		return 0, true, nil
+	}
+	q.DayUsed += n
+	q.MonthUsed += n
+	return 0, true, qs.save(key, q)
+}
+
+// refund n pushes used by use, eg: the push is not submitted,
+// the counters reset since then are not refunded
+func (qs *quotaStore) refund(tenant, sender string, n int64) error {
+	qs.locker.Lock()
+	defer qs.locker.Unlock()
+	var key = utils.JoinTenant(tenant, sender)
+	q, ok := qs.quotas[key]
+	if !ok || n <= 0 {
+		return nil
+	}
+	q.reset(time.Now().UTC())
+	q.DayUsed -= n
+	if q.DayUsed < 0 {
+		q.DayUsed = 0
+	}
+	q.MonthUsed -= n
+	if q.MonthUsed < 0 {
+		q.MonthUsed = 0
+	}
+	return qs.save(key, q)
+}
+
+// all the sender quotas of the tenant
+func (qs *quotaStore) all(tenant string) []Quota {
+	qs.locker.Lock()
+	defer qs.locker.Unlock()
+	var now = time.Now().UTC()
+	var quotas = make([]Quota, 0)
+	for key, q := range qs.quotas {
+		if t, _ := utils.SplitTenant(key); t != tenant {
+			continue
+		}
+		q.reset(now)
+		quotas = append(quotas, q)
+	}
+	sort.Slice(quotas, func(i, j int) bool {
+		return quotas[i].Sender < quotas[j].Sender
+	})
+	return quotas
+}
@@ -0,0 +1,130 @@
+package pusher
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestQuotaUse(t *testing.T) {
+	var tests = []struct {
+		name    string
+		daily   int64
+		monthly int64
+		used    int64
+		n       int64
+		ok      bool
+		dayUsed int64
+	}{
+		{"unlimited", 0, 0, 100, 1, true, 101},
+		{"in the daily", 3, 0, 2, 1, true, 3},
+		{"over the daily", 3, 0, 3, 1, false, 3},
+		{"over the monthly", 0, 3, 3, 1, false, 3},
+		{"many over the daily", 3, 0, 1, 3, false, 1},
+		{"check one left", 3, 0, 2, 0, true, 2},
+		{"check none left", 3, 0, 3, 0, false, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			qs, err := newQuotaStore(newMemoryBucket())
+			if err != nil {
+				t.Fatal(err)
+			}
+			qs.set("", "sendsms", test.daily, test.monthly)
+			qs.use("", "sendsms", test.used)
+			wait, ok, err := qs.use("", "sendsms", test.n)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ok != test.ok {
+				t.Errorf("use %d ok %v, want %v", test.n, ok, test.ok)
+			}
+			if !ok && wait <= 0 {
+				t.Errorf("the exceeded quota should wait the reset, got %v", wait)
+			}
+			if q := qs.all("")[0]; q.DayUsed != test.dayUsed || q.MonthUsed != test.dayUsed {
+				t.Errorf("used %d/%d, want %d", q.DayUsed, q.MonthUsed, test.dayUsed)
+			}
+		})
+	}
+}
+
+func TestQuotaRefund(t *testing.T) {
+	qs, _ := newQuotaStore(newMemoryBucket())
+	qs.set("acme", "sendsms", 1, 0)
+	if _, ok, _ := qs.use("acme", "sendsms", 1); !ok {
+		t.Fatal("the first push should be allowed")
+	}
+	if _, ok, _ := qs.use("acme", "sendsms", 1); ok {
+		t.Fatal("the push over the quota should be rejected")
+	}
+	qs.refund("acme", "sendsms", 1)
+	qs.refund("acme", "sendsms", 1)
+	if q := qs.all("acme")[0]; q.DayUsed != 0 || q.MonthUsed != 0 {
+		t.Fatalf("the refund should not go below 0, got %d/%d", q.DayUsed, q.MonthUsed)
+	}
+	if _, ok, _ := qs.use("acme", "sendsms", 1); !ok {
+		t.Fatal("the refunded push should be allowed")
+	}
+}
+
+func TestPushQuota(t *testing.T) {
+	sp, p := newTestSPusher(t)
+	sp.storer.Set(Pusher{ID: "4711", Senders: []string{"sendsms"}})
+	sp.quotas.set("", "sendsms", 1, 0)
+	var push = func() int {
+		rec := httptest.NewRecorder()
+		sp.handlePush(rec, postForm("/pusher/sendsms/push", url.Values{
+			"pusher": {"4711"},
+			"data":   {"hello"},
+			"force":  {"true"},
+		}, nil), "sendsms")
+		return rec.Code
+	}
+
+	// the push failed to submit give the quota back
+	p.err = errors.New("periodic unavailable")
+	if code := push(); code != http.StatusInternalServerError {
+		t.Fatalf("push status %d, want %d", code, http.StatusInternalServerError)
+	}
+	p.err = nil
+	if code := push(); code != http.StatusOK {
+		t.Fatalf("push status %d, want %d", code, http.StatusOK)
+	}
+	if code := push(); code != http.StatusTooManyRequests {
+		t.Fatalf("push status %d, want %d", code, http.StatusTooManyRequests)
+	}
+}
+
+func TestPushAllQuota(t *testing.T) {
+	sp, p := newTestSPusher(t)
+	sp.quotas.set("", "sendsms", 2, 0)
+	var pushAll = func() int {
+		rec := httptest.NewRecorder()
+		sp.handlePushAll(rec, postForm("/pusher/sendsms/pushall", url.Values{
+			"data":  {"hello"},
+			"force": {"true"},
+		}, nil), "sendsms")
+		return rec.Code
+	}
+
+	// the pushall use no quota, the worker pushes use it one by one
+	for i := 0; i < 3; i++ {
+		if code := pushAll(); code != http.StatusOK {
+			t.Fatalf("pushall status %d, want %d", code, http.StatusOK)
+		}
+	}
+	if q := sp.quotas.all("")[0]; q.DayUsed != 0 {
+		t.Fatalf("the pushall should not use the quota, used %d", q.DayUsed)
+	}
+
+	sp.quotas.use("", "sendsms", 2)
+	if code := pushAll(); code != http.StatusTooManyRequests {
+		t.Fatalf("pushall status %d without push left, want %d", code, http.StatusTooManyRequests)
+	}
+	if jobs := p.submitted(); len(jobs) != 3 {
+		t.Fatalf("submitted %d pushall jobs, want 3", len(jobs))
+	}
+}
@@ -0,0 +1,75 @@
+package pusher
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit a token bucket rate limit, the bucket fill rate tokens per second up to burst
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter limit the api key request rate per route class, the route class is the scope
+type rateLimiter struct {
+	locker  sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[string]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{
+		limits:  make(map[string]RateLimit),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+func (l *rateLimiter) setLimit(class string, limit RateLimit) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	if limit.Rate <= 0 {
+		delete(l.limits, class)
+		return
+	}
+	l.limits[class] = limit
+}
+
+// allow take a token of the key and route class,
+// otherwise return how long to wait for the next token
+func (l *rateLimiter) allow(key APIKey, class string) (time.Duration, bool) {
+	return l.allowAt(key, class, time.Now())
+}
+
+func (l *rateLimiter) allowAt(key APIKey, class string, now time.Time) (time.Duration, bool) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	limit, ok := key.RateLimits[class]
+	if !ok {
+		limit, ok = l.limits[class]
+	}
+	if !ok || limit.Rate <= 0 {
+		return 0, true
+	}
+	var burst = math.Max(float64(limit.Burst), 1)
+	var name = key.Key + ":" + class
+	bucket, ok := l.buckets[name]
+	if !ok {
+		bucket = &tokenBucket{tokens: burst, last: now}
+		l.buckets[name] = bucket
+	}
+	bucket.tokens = math.Min(burst, bucket.tokens+now.Sub(bucket.last).Seconds()*limit.Rate)
+	bucket.last = now
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		return 0, true
+	}
+	var wait = (1 - bucket.tokens) / limit.Rate
+	return time.Duration(wait * float64(time.Second)), false
+}
@@ -0,0 +1,43 @@
+package pusher
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterBurst(t *testing.T) {
+	var l = newRateLimiter()
+	l.setLimit(ScopePush, RateLimit{Rate: 2, Burst: 3})
+	var key = APIKey{Key: "k"}
+	var now = time.Now()
+	for i := 0; i < 3; i++ {
+		if _, ok := l.allowAt(key, ScopePush, now); !ok {
+			t.Fatalf("the request %d in the burst should be allowed", i)
+		}
+	}
+	wait, ok := l.allowAt(key, ScopePush, now)
+	if ok {
+		t.Fatal("the request over the burst should be limited")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("wait %v, want 500ms", wait)
+	}
+	if _, ok = l.allowAt(key, ScopePush, now.Add(wait)); !ok {
+		t.Fatal("the request should be allowed after the wait")
+	}
+	// the other route class is not limited
+	if _, ok = l.allowAt(key, ScopePushAll, now); !ok {
+		t.Fatal("the route class without limit should be allowed")
+	}
+}
+
+func TestRateLimiterKeyLimit(t *testing.T) {
+	var l = newRateLimiter()
+	l.setLimit(ScopePush, RateLimit{Rate: 100, Burst: 100})
+	var key = APIKey{Key: "k", RateLimits: map[string]RateLimit{ScopePush: {Rate: 1, Burst: 1}}}
+	var now = time.Now()
+	l.allowAt(key, ScopePush, now)
+	if _, ok := l.allowAt(key, ScopePush, now); ok {
+		t.Fatal("the api key limit should override the route class limit")
+	}
+}
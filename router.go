@@ -2,14 +2,16 @@ package pusher
 
 import (
 	"encoding/json"
+	"github.com/Lupino/pusher/tracing"
+	"github.com/Lupino/pusher/utils"
 	"github.com/blevesearch/bleve"
-	"github.com/blevesearch/bleve/search/query"
 	"github.com/gorilla/mux"
-	"github.com/mholt/binding"
 	"github.com/unrolled/render"
-	"log"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 /**
@@ -28,6 +30,10 @@ import (
  * @apiDefine DataParam
  * @apiParam {Object} data Sender data.
  * @apiParam {Number} [schedat] when to sched the job.
+ * @apiParam {String=high, normal, low} [priority=normal] the message priority, the job is submit to the periodic func of the priority.
+ * @apiParam {Number} [expiresAt] the unix time the message is useless, the worker drop the expired job.
+ * @apiParam {Number} [ttl] the seconds the message is useful after the schedat, same as expiresAt.
+ * @apiParam {Object} [meta] the string metadata travel with the job to the sender, eg: <code>{"traceId": "xxx"}</code>.
  * @apiParamExample {json} MailSender data example:
  *     {
  *       "subject": "subject",
@@ -44,11 +50,20 @@ import (
  */
 /**
  * @apiDefine PusherParam
- * @apiParam {String} pusher Pusher unique ID.
+ * @apiParam {String} pusher Pusher unique ID, can not contain <code>/</code>.
  * @apiParam {String} [email] Pusher email address.
  * @apiParam {String} [phoneNumber] Pusher phone number.
  * @apiParam {String} [nickname] Pusher nickname.
  * @apiParam {Number} [createdAt] Pusher created time.
+ * @apiParam {String[]} [tags] Pusher tags, a json array or repeat the form param for each tag.
+ * @apiParam {String[]} [senders] Pusher senders, a json array or repeat the form param for each sender.
+ * @apiParam {Boolean} [force=false] set the senders even they are not registered.
+ */
+
+/**
+ * @apiDefine JSONBody
+ * @apiDescription The params can be an url encoded form
+ * or a json object body with the header <code>Content-Type: application/json</code>.
  */
 
 /**
@@ -90,12 +105,148 @@ func sendJSONResponse(w http.ResponseWriter, status int, key string, data interf
 	}
 }
 
+// sendRetryAfter reply too many requests with the Retry-After header in seconds
+func sendRetryAfter(w http.ResponseWriter, wait time.Duration, err string) {
+	var seconds = int64(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	sendJSONResponse(w, http.StatusTooManyRequests, "err", err)
+}
+
+// checkQuota use n pushes of the sender quota, n is 0 to check there is one push left only
+func (s SPusher) checkQuota(w http.ResponseWriter, req *http.Request, sender string, n int64) bool {
+	wait, ok, err := s.quotas.use(s.tenant, sender, n)
+	if err != nil {
+		s.reqLogger(req).Error("quotaStore.use() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if !ok {
+		sendRetryAfter(w, wait, "sender "+sender+" exceeded the quota.")
+		return false
+	}
+	return true
+}
+
+// refundQuota refund n pushes used by checkQuota, eg: the push is not submitted
+func (s SPusher) refundQuota(req *http.Request, sender string, n int64) {
+	if err := s.quotas.refund(s.tenant, sender, n); err != nil {
+		s.reqLogger(req).Error("quotaStore.refund() failed", "err", err)
+	}
+}
+
+// parseParams read the request params, reply bad request if the json body is invalid
+func parseParams(w http.ResponseWriter, req *http.Request) (requestParams, bool) {
+	params, err := readParams(req)
+	if err != nil {
+		sendJSONResponse(w, http.StatusBadRequest, "err", "invalid request body ("+err.Error()+").")
+		return params, false
+	}
+	return params, true
+}
+
+// checkSender reject the sender which no worker announced unless force
+func (s SPusher) checkSender(w http.ResponseWriter, sender string, force bool) bool {
+	if force || s.senders.has(sender) {
+		return true
+	}
+	sendJSONResponse(w, http.StatusNotAcceptable, "err", "sender "+sender+" not registered.")
+	return false
+}
+
+// allowSender reject the sender which the api key of the request is not allowed to use,
+// the sender in the route is checked by scope, check the senders in the params by it
+func allowSender(w http.ResponseWriter, req *http.Request, sender string) bool {
+	if key, ok := requestKey(req); ok && !key.AllowSender(sender) {
+		sendJSONResponse(w, http.StatusForbidden, "err", "X-App-Key is not allowed to use the sender "+sender+".")
+		return false
+	}
+	return true
+}
+
+// checkFields reject the pusher without the fields required by the sender
+func (s SPusher) checkFields(w http.ResponseWriter, sender string, p Pusher) bool {
+	if fields := s.senders.missing(sender, p); len(fields) > 0 {
+		sendJSONResponse(w, http.StatusBadRequest, "err", "pusher "+p.ID+" has no "+strings.Join(fields, ", ")+" required by the sender "+sender+".")
+		return false
+	}
+	return true
+}
+
+// checkData validate the push data with the sender json schema
+func (s SPusher) checkData(w http.ResponseWriter, sender, data string) bool {
+	errs, err := s.senders.validate(sender, data)
+	if err != nil {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "data is not a valid json ("+err.Error()+").")
+		return false
+	}
+	if len(errs) > 0 {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "", map[string]interface{}{
+			"err":    "data is invalid.",
+			"errors": errs,
+		})
+		return false
+	}
+	return true
+}
+
+/**
+ * @apiDefine InvalidDataError
+ * @apiError {String} err data is invalid.
+ * @apiError {Object[]} errors the field errors validate by the sender json schema.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 422 Unprocessable Entity
+ *     {
+ *       "err": "data is invalid.",
+ *       "errors": [
+ *         {
+ *           "field": "subject",
+ *           "description": "subject is required"
+ *         }
+ *       ]
+ *     }
+ */
+
+/**
+ * @apiDefine SenderNotRegisteredError
+ * @apiError {String} err sender <code>sender</code> not registered.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 406 Not Acceptable
+ *     {
+ *       "err": "sender sendmial not registered."
+ *     }
+ */
+
+/**
+ * @apiDefine MissingFieldsError
+ * @apiError {String} err the pusher has no fields required by the sender.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 400 Bad Request
+ *     {
+ *       "err": "pusher 4711 has no email required by the sender sendmail."
+ *     }
+ */
+
+/**
+ * @apiDefine QuotaExceededError
+ * @apiError {String} err sender <code>sender</code> exceeded the quota.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 429 Too Many Requests
+ *     Retry-After: 3600
+ *     {
+ *       "err": "sender sendsms exceeded the quota."
+ *     }
+ */
+
 /**
  * @api {post} /pusher/:sender/add Add a sender to an exists pusher.
  * @apiName addSender
  * @apiGroup Sender
  *
  * @apiUse SenderParam
+ * @apiParam {Boolean} [force=false] add the sender even it is not registered.
  * @apiExample Example usage:
  * curl -i http://pusher_host/pusher/sendmail/add -d pusher=lupinno
  *
@@ -103,18 +254,25 @@ func sendJSONResponse(w http.ResponseWriter, status int, key string, data interf
  * @apiSuccess {String} result OK.
  * @apiUse ResultOK
  * @apiUse NotFoundError
+ * @apiUse SenderNotRegisteredError
  *
  */
 func (s SPusher) handleAddSender(w http.ResponseWriter, req *http.Request, sender string) {
-	req.ParseForm()
-	pusher := req.Form.Get("pusher")
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	pusher := params.Get("pusher")
+	if !s.checkSender(w, sender, params.Bool("force")) {
+		return
+	}
 	var p Pusher
 	if p, _ = s.storer.Get(pusher); p.ID == "" {
 		sendJSONResponse(w, http.StatusNotFound, "err", "pusher "+pusher+" not exists.")
 		return
 	}
 	if err := s.addSender(p, sender); err != nil {
-		log.Printf("addSender() failed (%s)", err)
+		s.reqLogger(req).Error("addSender() failed", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -137,15 +295,18 @@ func (s SPusher) handleAddSender(w http.ResponseWriter, req *http.Request, sende
  *
  */
 func (s SPusher) handleRemoveSender(w http.ResponseWriter, req *http.Request, sender string) {
-	req.ParseForm()
-	pusher := req.Form.Get("pusher")
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	pusher := params.Get("pusher")
 	var p Pusher
 	if p, _ = s.storer.Get(pusher); p.ID == "" {
 		sendJSONResponse(w, http.StatusNotFound, "err", "pusher "+pusher+" not exists.")
 		return
 	}
 	if err := s.removeSender(p, sender); err != nil {
-		log.Printf("removeSender() failed (%s)", err)
+		s.reqLogger(req).Error("removeSender() failed", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -174,7 +335,7 @@ func (s SPusher) handleAddTag(w http.ResponseWriter, req *http.Request, pusher,
 		return
 	}
 	if err := s.addTag(p, tag); err != nil {
-		log.Printf("addTag() failed (%s)", err)
+		s.reqLogger(req).Error("addTag() failed", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -203,7 +364,7 @@ func (s SPusher) handleRemoveTag(w http.ResponseWriter, req *http.Request, pushe
 		return
 	}
 	if err := s.removeTag(p, tag); err != nil {
-		log.Printf("removeTag() failed (%s)", err)
+		s.reqLogger(req).Error("removeTag() failed", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -211,31 +372,87 @@ func (s SPusher) handleRemoveTag(w http.ResponseWriter, req *http.Request, pushe
 }
 
 type pushForm struct {
-	Pusher  string
-	Data    string
-	SchedAt string
-	Force   bool
-}
-
-func (f *pushForm) FieldMap(_ *http.Request) binding.FieldMap {
-	return binding.FieldMap{
-		&f.Pusher: binding.Field{
-			Form:     "pusher",
-			Required: true,
-		},
-		&f.Data: binding.Field{
-			Form:     "data",
-			Required: true,
-		},
-		&f.SchedAt: binding.Field{
-			Form:     "schedat",
-			Required: false,
-		},
-		&f.Force: binding.Field{
-			Form:     "force",
-			Required: false,
-		},
+	Pusher    string
+	Data      string
+	SchedAt   string
+	Priority  string
+	ExpiresAt int64
+	Meta      map[string]string
+	Force     bool
+}
+
+// bindMeta read the meta param, a json object of strings
+func bindMeta(w http.ResponseWriter, params requestParams) (meta map[string]string, ok bool) {
+	if !params.Has("meta") {
+		return nil, true
+	}
+	if err := json.Unmarshal([]byte(params.Get("meta")), &meta); err != nil {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "invalid meta ("+err.Error()+").")
+		return nil, false
+	}
+	return meta, true
+}
+
+// bindExpiresAt read the expiresAt or the ttl param, the ttl start from the schedat
+func bindExpiresAt(w http.ResponseWriter, params requestParams, schedat string) (expiresAt int64, ok bool) {
+	var err error
+	if params.Has("expiresAt") {
+		if expiresAt, err = strconv.ParseInt(params.Get("expiresAt"), 10, 64); err != nil || expiresAt < 0 {
+			sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "invalid expiresAt.")
+			return 0, false
+		}
+		return expiresAt, true
+	}
+	if params.Has("ttl") {
+		var ttl int64
+		if ttl, err = strconv.ParseInt(params.Get("ttl"), 10, 64); err != nil || ttl <= 0 {
+			sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "invalid ttl.")
+			return 0, false
+		}
+		var start = time.Now().Unix()
+		if sched, _ := strconv.ParseInt(schedat, 10, 64); sched > start {
+			start = sched
+		}
+		return start + ttl, true
+	}
+	return 0, true
+}
+
+// bindPriority read the priority param, reply unprocessable entity if the priority is unknown
+func bindPriority(w http.ResponseWriter, params requestParams) (string, bool) {
+	var priority = params.Get("priority")
+	if !ValidPriority(priority) {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "unknown priority "+priority+".")
+		return priority, false
+	}
+	return priority, true
+}
+
+func bindPushForm(w http.ResponseWriter, req *http.Request) (f pushForm, ok bool) {
+	var params requestParams
+	if params, ok = parseParams(w, req); !ok {
+		return
+	}
+	f.Pusher = params.Get("pusher")
+	f.Data = params.Get("data")
+	f.SchedAt = params.Get("schedat")
+	f.Force = params.Bool("force")
+	if f.Pusher == "" || f.Data == "" {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "pusher and data is required.")
+		return f, false
+	}
+	if !ValidPusherID(f.Pusher) {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "invalid pusher "+f.Pusher+".")
+		return f, false
+	}
+	if f.Priority, ok = bindPriority(w, params); !ok {
+		return
+	}
+	if f.Meta, ok = bindMeta(w, params); !ok {
+		return
 	}
+	f.ExpiresAt, ok = bindExpiresAt(w, params, f.SchedAt)
+	return f, ok
 }
 
 /**
@@ -243,24 +460,43 @@ func (f *pushForm) FieldMap(_ *http.Request) binding.FieldMap {
  * @apiName push
  * @apiGroup Push
  *
+ * @apiDescription The job is submitted to the periodic func of the tenant, eg: `pusher:shop:sendmail:high`,
+ * the job of a tenant is named `shop/pusher_xxxx`.
+ *
  * @apiUse SenderParam
  * @apiUse DataParam
- * @apiParam {Boolean} [force=false] force push.
+ * @apiParam {Boolean} [force=false] force push, even the pusher has not the sender or the sender is not registered.
  *
+ * @apiUse JSONBody
  * @apiExample Example usage:
  * curl -i http://pusher_host/pusher/sendmail/push \
  *      -d pusher=lupino \
  *      -d data='{"subject": "subject", "text": "text"}'
  *
+ * curl -i http://pusher_host/pusher/sendmail/push \
+ *      -H 'Content-Type: application/json' \
+ *      -d '{"pusher": "lupino", "data": {"subject": "subject", "text": "text"}}'
+ *
  * @apiSuccess {String} result OK.
  * @apiSuccess {String} name The periodic job name.
  * @apiUse PushResult
+ * @apiUse SenderNotRegisteredError
+ * @apiUse InvalidDataError
+ * @apiUse MissingFieldsError
+ * @apiUse QuotaExceededError
  *
  */
 func (s SPusher) handlePush(w http.ResponseWriter, req *http.Request, sender string) {
-	f := new(pushForm)
-	errs := binding.Bind(req, f)
-	if errs.Handle(w) {
+	f, ok := bindPushForm(w, req)
+	if !ok {
+		return
+	}
+
+	if !s.checkSender(w, sender, f.Force) {
+		return
+	}
+
+	if !s.checkData(w, sender, f.Data) {
 		return
 	}
 
@@ -280,8 +516,21 @@ func (s SPusher) handlePush(w http.ResponseWriter, req *http.Request, sender str
 		return
 	}
 
-	if name, err = s.push(sender, f.Pusher, f.Data, f.SchedAt); err != nil {
-		log.Printf("push() failed (%s)", err)
+	if !s.checkFields(w, sender, p) {
+		return
+	}
+
+	if !s.checkQuota(w, req, sender, 1) {
+		return
+	}
+
+	var payload = utils.Payload{Data: f.Data, ExpiresAt: f.ExpiresAt, Meta: f.Meta, Trace: tracing.Inject(req.Context(), nil)}
+	if s.snapshot {
+		payload.Pusher = p.Bytes()
+	}
+	if name, err = s.push(sender, f.Pusher, payload, f.SchedAt, f.Priority); err != nil {
+		s.reqLogger(req).Error("push() failed", "err", err)
+		s.refundQuota(req, sender, 1)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -289,26 +538,36 @@ func (s SPusher) handlePush(w http.ResponseWriter, req *http.Request, sender str
 }
 
 type pushAllForm struct {
-	Data    string
-	Tag     string
-	SchedAt string
+	Data      string
+	Tag       string
+	SchedAt   string
+	Priority  string
+	ExpiresAt int64
+	Meta      map[string]string
+	Force     bool
 }
 
-func (f *pushAllForm) FieldMap(_ *http.Request) binding.FieldMap {
-	return binding.FieldMap{
-		&f.Data: binding.Field{
-			Form:     "data",
-			Required: true,
-		},
-		&f.SchedAt: binding.Field{
-			Form:     "schedat",
-			Required: false,
-		},
-		&f.Tag: binding.Field{
-			Form:     "tag",
-			Required: false,
-		},
+func bindPushAllForm(w http.ResponseWriter, req *http.Request) (f pushAllForm, ok bool) {
+	var params requestParams
+	if params, ok = parseParams(w, req); !ok {
+		return
+	}
+	f.Data = params.Get("data")
+	f.Tag = params.Get("tag")
+	f.SchedAt = params.Get("schedat")
+	f.Force = params.Bool("force")
+	if f.Data == "" {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "data is required.")
+		return f, false
+	}
+	if f.Priority, ok = bindPriority(w, params); !ok {
+		return
+	}
+	if f.Meta, ok = bindMeta(w, params); !ok {
+		return
 	}
+	f.ExpiresAt, ok = bindExpiresAt(w, params, f.SchedAt)
+	return f, ok
 }
 
 /**
@@ -316,9 +575,16 @@ func (f *pushAllForm) FieldMap(_ *http.Request) binding.FieldMap {
  * @apiName pushall
  * @apiGroup Push
  *
+ * @apiDescription The job is submitted to the periodic func of the tenant, eg: `pusher:shop:pushall:high`,
+ * the job of a tenant is named `shop/sendmail_xxxx`.
+ * The pushall itself use no quota, it is rejected when no push is left,
+ * the worker push to every pusher with the sender quota.
+ * The push to a pusher without the fields required by the sender is rejected, counted as failed of the pushall.
+ *
  * @apiParam {String=sendmail, sendsms, customSenderName} sender Sender name.
  * @apiUse DataParam
  * @apiParam {String} [tag] push all to the pusher which has a tag.
+ * @apiParam {Boolean} [force=false] force push, even the sender is not registered.
  *
  * @apiExample Example usage:
  * curl -i http://pusher_host/pusher/sendmail/pushall \
@@ -327,12 +593,26 @@ func (f *pushAllForm) FieldMap(_ *http.Request) binding.FieldMap {
  * @apiSuccess {String} result OK.
  * @apiSuccess {String} name The periodic job name.
  * @apiUse PushResult
+ * @apiUse SenderNotRegisteredError
+ * @apiUse InvalidDataError
+ * @apiUse QuotaExceededError
  *
  */
 func (s SPusher) handlePushAll(w http.ResponseWriter, req *http.Request, sender string) {
-	f := new(pushAllForm)
-	errs := binding.Bind(req, f)
-	if errs.Handle(w) {
+	f, ok := bindPushAllForm(w, req)
+	if !ok {
+		return
+	}
+
+	if !s.checkSender(w, sender, f.Force) {
+		return
+	}
+
+	if !s.checkData(w, sender, f.Data) {
+		return
+	}
+
+	if !s.checkQuota(w, req, sender, 0) {
 		return
 	}
 
@@ -341,11 +621,14 @@ func (s SPusher) handlePushAll(w http.ResponseWriter, req *http.Request, sender
 		err  error
 	)
 	data, _ := json.Marshal(map[string]string{
-		"data": f.Data,
-		"tag":  f.Tag,
+		"data":      f.Data,
+		"tag":       f.Tag,
+		"priority":  f.Priority,
+		"expiresAt": strconv.FormatInt(f.ExpiresAt, 10),
 	})
-	if name, err = s.pushAll(sender, string(data), f.SchedAt); err != nil {
-		log.Printf("pushAll() failed (%s)", err)
+	var payload = utils.Payload{Data: string(data), ExpiresAt: f.ExpiresAt, Meta: f.Meta, Trace: tracing.Inject(req.Context(), nil)}
+	if name, err = s.pushAll(sender, payload, f.SchedAt, f.Priority); err != nil {
+		s.reqLogger(req).Error("pushAll() failed", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -360,6 +643,7 @@ func (s SPusher) handlePushAll(w http.ResponseWriter, req *http.Request, sender
  *
  * @apiParam {String=pushall, sendmail, sendsms, customSenderName} sender Sender name.
  * @apiParam {String} name The periodic job name.
+ * @apiParam {String=high, normal, low} [priority=normal] the priority of the push.
  *
  * @apiExample Example usage:
  * curl -i http://pusher_host/pusher/sendmail/cancelpush \
@@ -370,13 +654,24 @@ func (s SPusher) handlePushAll(w http.ResponseWriter, req *http.Request, sender
  *
  */
 func (s SPusher) handleCancelPush(w http.ResponseWriter, req *http.Request, sender string) {
-	req.ParseForm()
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
 	var (
-		name = req.Form.Get("name")
+		name = params.Get("name")
 		err  error
 	)
-	if err = s.p.RemoveJob(PREFIX+sender, name); err != nil {
-		log.Printf("periodic.Client.RemoveJob() failed (%s)", err)
+	priority, ok := bindPriority(w, params)
+	if !ok {
+		return
+	}
+	if tenant, _ := utils.SplitTenant(name); tenant != s.tenant {
+		sendJSONResponse(w, http.StatusForbidden, "err", "job "+name+" is not in the tenant.")
+		return
+	}
+	if err = s.p.RemoveJob(FuncName(s.funcPrefix(), sender, priority), name); err != nil {
+		s.reqLogger(req).Error("periodic.Client.RemoveJob() failed", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -420,7 +715,7 @@ func wapperSenderHandle(handle func(http.ResponseWriter, *http.Request, string))
 func (s SPusher) handleGetPusher(w http.ResponseWriter, req *http.Request, pusher string) {
 	p, err := s.storer.Get(pusher)
 	if err != nil {
-		log.Printf("Storer.Get() failed (%s)", err)
+		s.reqLogger(req).Error("Storer.Get() failed", "err", err)
 	}
 	if p.ID == "" {
 		sendJSONResponse(w, http.StatusNotFound, "err", "pusher "+pusher+" not exists.")
@@ -484,7 +779,7 @@ func (s SPusher) handleGetAllPusher(w http.ResponseWriter, req *http.Request) {
 
 	total, pushers, err := s.storer.GetAll(from, size)
 	if err != nil {
-		log.Printf("Storer.GetAll() failed (%s)", err)
+		s.reqLogger(req).Error("Storer.GetAll() failed", "err", err)
 	}
 
 	sendJSONResponse(w, http.StatusOK, "", map[string]interface{}{
@@ -567,14 +862,10 @@ func (s SPusher) handleSearchPusher(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	query, err := query.ParseQuery([]byte(q))
-	if err != nil {
-		query = bleve.NewQueryStringQuery(q)
-	}
-	searchRequest := bleve.NewSearchRequestOptions(query, size, from, false)
+	searchRequest := bleve.NewSearchRequestOptions(parseQuery(q), size, from, false)
 	searchResult, err := s.index.Search(searchRequest)
 	if err != nil {
-		log.Printf("bleve.Index.Search() failed(%s)", err)
+		s.reqLogger(req).Error("bleve.Index.Search() failed", "err", err)
 		sendJSONResponse(w, http.StatusBadRequest, "err", err)
 		return
 	}
@@ -603,6 +894,7 @@ func (s SPusher) handleSearchPusher(w http.ResponseWriter, req *http.Request) {
  * @apiGroup Pusher
  *
  * @apiUse PusherParam
+ * @apiUse JSONBody
  * @apiExample Example usage:
  * curl -i http://pusher_host/pusher/pushers/ \
  *      -d pusher=lupino \
@@ -611,6 +903,10 @@ func (s SPusher) handleSearchPusher(w http.ResponseWriter, req *http.Request) {
  *      -d nickname=xxx \
  *      -d createdAt=1456403493
  *
+ * curl -i http://pusher_host/pusher/pushers/ \
+ *      -H 'Content-Type: application/json' \
+ *      -d '{"pusher": "lupino", "email": "lmjubuntu@gmail.com", "tags": ["friends"], "senders": ["sendmail"]}'
+ *
  *
  * @apiSuccess {String} result OK.
  * @apiUse ResultOK
@@ -623,20 +919,36 @@ func (s SPusher) handleSearchPusher(w http.ResponseWriter, req *http.Request) {
  *     }
  */
 func (s SPusher) handleAddPusher(w http.ResponseWriter, req *http.Request) {
-	req.ParseForm()
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
 	var p = Pusher{}
-	p.ID = req.Form.Get("pusher")
-	p.Email = req.Form.Get("email")
-	p.NickName = req.Form.Get("nickname")
-	p.PhoneNumber = req.Form.Get("phoneNumber")
-	p.CreatedAt, _ = strconv.ParseInt(req.Form.Get("createdAt"), 10, 64)
+	p.ID = params.Get("pusher")
+	p.Email = params.Get("email")
+	p.NickName = params.Get("nickname")
+	p.PhoneNumber = params.Get("phoneNumber")
+	p.CreatedAt, _ = strconv.ParseInt(params.Get("createdAt"), 10, 64)
 	if p.ID == "" {
 		sendJSONResponse(w, http.StatusNotAcceptable, "err", "pusher is required.")
 		return
 	}
+	if !ValidPusherID(p.ID) {
+		sendJSONResponse(w, http.StatusNotAcceptable, "err", "invalid pusher "+p.ID+".")
+		return
+	}
+	for _, tag := range params.Strings("tags") {
+		p.AddTag(tag)
+	}
+	for _, sender := range params.Strings("senders") {
+		if !allowSender(w, req, sender) || !s.checkSender(w, sender, params.Bool("force")) {
+			return
+		}
+		p.AddSender(sender)
+	}
 
-	if err := s.storer.Set(p); err != nil {
-		log.Printf("SetPusher() failed(%s)", err)
+	if err := s.savePusher(p); err != nil {
+		s.reqLogger(req).Error("SetPusher() failed", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -688,7 +1000,7 @@ func (s SPusher) handleUpdatePusher(w http.ResponseWriter, req *http.Request, pu
 	var p Pusher
 	var err error
 	if p, err = s.storer.Get(pusher); err != nil {
-		log.Printf("Storer.Get() failed(%s)", err)
+		s.reqLogger(req).Error("Storer.Get() failed", "err", err)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -697,61 +1009,1537 @@ func (s SPusher) handleUpdatePusher(w http.ResponseWriter, req *http.Request, pu
 		return
 	}
 
-	if req.Form.Get("email") != "" {
-		p.Email = req.Form.Get("email")
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	if params.Get("email") != "" {
+		p.Email = params.Get("email")
 	}
-	if req.Form.Get("nickname") != "" {
-		p.NickName = req.Form.Get("nickname")
+	if params.Get("nickname") != "" {
+		p.NickName = params.Get("nickname")
 	}
-	if req.Form.Get("phoneNumber") != "" {
-		p.PhoneNumber = req.Form.Get("phoneNumber")
+	if params.Get("phoneNumber") != "" {
+		p.PhoneNumber = params.Get("phoneNumber")
 	}
-	if req.Form.Get("createdAt") != "" {
-		p.CreatedAt, _ = strconv.ParseInt(req.Form.Get("createdAt"), 10, 64)
+	if params.Get("createdAt") != "" {
+		p.CreatedAt, _ = strconv.ParseInt(params.Get("createdAt"), 10, 64)
+	}
+	if params.Has("tags") {
+		p.Tags = nil
+		for _, tag := range params.Strings("tags") {
+			p.AddTag(tag)
+		}
+	}
+	if params.Has("senders") {
+		var next Pusher
+		for _, sender := range params.Strings("senders") {
+			if !allowSender(w, req, sender) || !s.checkSender(w, sender, params.Bool("force")) {
+				return
+			}
+			next.AddSender(sender)
+		}
+		// removing a sender is using it too
+		for _, sender := range p.Senders {
+			if !next.HasSender(sender) && !allowSender(w, req, sender) {
+				return
+			}
+		}
+		p.Senders = next.Senders
 	}
-	if err = s.storer.Set(p); err != nil {
+	if err = s.savePusher(p); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 	sendJSONResponse(w, http.StatusOK, "result", "OK")
 }
 
-func wapperPusherHandle(handle func(http.ResponseWriter, *http.Request, string)) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, req *http.Request) {
-		vars := mux.Vars(req)
-		pusher := vars["pusher"]
-		handle(w, req, pusher)
+/**
+ * @apiDefine BulkParam
+ * @apiParam {String[]} [pusher] Pusher unique ID list, repeat the param for each pusher.
+ * @apiParam {String} [q] query string or query json object, used when no pusher is given.
+ */
+
+/**
+ * @apiDefine BulkResult
+ * @apiSuccess {String} result OK.
+ * @apiSuccess {Object} job The background bulk job.
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "result": "OK",
+ *       "job": {
+ *         "id": "5f2b8d1c9a7e3b40",
+ *         "op": "addTag",
+ *         "value": "friends",
+ *         "q": "senders:sendmail",
+ *         "status": "running",
+ *         "total": 0,
+ *         "processed": 0,
+ *         "changed": 0,
+ *         "failed": 0,
+ *         "createdAt": 1456403493
+ *       }
+ *     }
+ *
+ * @apiError {String} err pusher or q is required.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 406 Not Acceptable
+ *     {
+ *       "err": "pusher or q is required."
+ *     }
+ */
+
+func (s SPusher) handleBulk(w http.ResponseWriter, req *http.Request, op, value string) {
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	var (
+		pushers = params.Strings("pusher")
+		q       = params.Get("q")
+	)
+	if len(pushers) == 0 && q == "" {
+		sendJSONResponse(w, http.StatusNotAcceptable, "err", "pusher or q is required.")
+		return
+	}
+	for _, pusher := range pushers {
+		if !ValidPusherID(pusher) {
+			sendJSONResponse(w, http.StatusNotAcceptable, "err", "invalid pusher "+pusher+".")
+			return
+		}
+	}
+	if op == BulkAddSender || op == BulkRemoveSender {
+		if !allowSender(w, req, value) {
+			return
+		}
+	}
+	if op == BulkAddSender {
+		if !s.checkSender(w, value, params.Bool("force")) {
+			return
+		}
 	}
+	job := s.startBulk(BulkJob{Op: op, Value: value, Query: q}, pushers)
+	sendJSONResponse(w, http.StatusOK, "", map[string]interface{}{"job": job, "result": "OK"})
 }
 
-func wapperTagHandle(handle func(http.ResponseWriter, *http.Request, string, string)) func(http.ResponseWriter, *http.Request) {
-	return func(w http.ResponseWriter, req *http.Request) {
-		vars := mux.Vars(req)
-		pusher := vars["pusher"]
-		tag := vars["tag"]
-		handle(w, req, pusher, tag)
+/**
+ * @api {post} /pusher/bulk/tags/:tag/add Add a tag to many pushers.
+ * @apiName BulkAddTag
+ * @apiGroup Bulk
+ *
+ * @apiParam {String} tag some tag.
+ * @apiUse BulkParam
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/bulk/tags/friends/add \
+ *      -d pusher=lupino \
+ *      -d pusher=4711
+ *
+ * @apiUse BulkResult
+ *
+ */
+func (s SPusher) handleBulkAddTag(w http.ResponseWriter, req *http.Request) {
+	s.handleBulk(w, req, BulkAddTag, mux.Vars(req)["tag"])
+}
+
+/**
+ * @api {post} /pusher/bulk/tags/:tag/delete Delete a tag from many pushers.
+ * @apiName BulkRemoveTag
+ * @apiGroup Bulk
+ *
+ * @apiParam {String} tag some tag.
+ * @apiUse BulkParam
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/bulk/tags/friends/delete \
+ *      -d q=tags:friends
+ *
+ * @apiUse BulkResult
+ *
+ */
+func (s SPusher) handleBulkRemoveTag(w http.ResponseWriter, req *http.Request) {
+	s.handleBulk(w, req, BulkRemoveTag, mux.Vars(req)["tag"])
+}
+
+/**
+ * @api {post} /pusher/bulk/:sender/add Add a sender to many pushers.
+ * @apiName BulkAddSender
+ * @apiGroup Bulk
+ *
+ * @apiParam {String=sendmail, sendsms, customSenderName} sender Sender name.
+ * @apiUse BulkParam
+ * @apiParam {Boolean} [force=false] add the sender even it is not registered.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/bulk/sendmail/add \
+ *      -d q=tags:friends
+ *
+ * @apiUse BulkResult
+ * @apiUse SenderNotRegisteredError
+ *
+ */
+func (s SPusher) handleBulkAddSender(w http.ResponseWriter, req *http.Request, sender string) {
+	s.handleBulk(w, req, BulkAddSender, sender)
+}
+
+/**
+ * @api {post} /pusher/bulk/:sender/delete Delete a sender from many pushers.
+ * @apiName BulkRemoveSender
+ * @apiGroup Bulk
+ *
+ * @apiParam {String=sendmail, sendsms, customSenderName} sender Sender name.
+ * @apiUse BulkParam
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/bulk/sendmail/delete \
+ *      -d pusher=lupino
+ *
+ * @apiUse BulkResult
+ *
+ */
+func (s SPusher) handleBulkRemoveSender(w http.ResponseWriter, req *http.Request, sender string) {
+	s.handleBulk(w, req, BulkRemoveSender, sender)
+}
+
+/**
+ * @api {get} /pusher/bulk/jobs/:job/ Get a bulk job progress
+ * @apiName GetBulkJob
+ * @apiGroup Bulk
+ *
+ * @apiParam {String} job The bulk job ID.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/bulk/jobs/5f2b8d1c9a7e3b40/
+ *
+ * @apiSuccess {Object} job The bulk job.
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "job": {
+ *         "id": "5f2b8d1c9a7e3b40",
+ *         "op": "addTag",
+ *         "value": "friends",
+ *         "q": "senders:sendmail",
+ *         "status": "done",
+ *         "total": 1000,
+ *         "processed": 1000,
+ *         "changed": 998,
+ *         "failed": 0,
+ *         "createdAt": 1456403493,
+ *         "finishedAt": 1456403495
+ *       }
+ *     }
+ *
+ * @apiError {String} err bulk job <code>job</code> not exists.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 404 Not Found
+ *     {
+ *       "err": "bulk job 5f2b8d1c9a7e3b40 not exists."
+ *     }
+ */
+func (s SPusher) handleGetBulkJob(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["job"]
+	job, ok := s.bulk.get(id)
+	if !ok {
+		sendJSONResponse(w, http.StatusNotFound, "err", "bulk job "+id+" not exists.")
+		return
 	}
+	sendJSONResponse(w, http.StatusOK, "job", job)
 }
 
-// NewRouter return new pusher router
-func (s SPusher) NewRouter() *mux.Router {
-	router := mux.NewRouter()
-	router.HandleFunc("/pusher/pushers/{pusher}/", wapperPusherHandle(s.handleGetPusher)).Methods("GET")
-	router.HandleFunc("/pusher/pushers/", s.handleGetAllPusher).Methods("GET")
-	router.HandleFunc("/pusher/search/", s.handleSearchPusher).Methods("GET")
+/**
+ * @api {get} /pusher/bulk/jobs/ Get recent bulk jobs
+ * @apiName GetBulkJobList
+ * @apiGroup Bulk
+ *
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/bulk/jobs/
+ *
+ * @apiSuccess {Object[]} jobs The bulk job list, newest first.
+ *
+ */
+func (s SPusher) handleGetBulkJobs(w http.ResponseWriter, req *http.Request) {
+	sendJSONResponse(w, http.StatusOK, "jobs", s.bulk.all())
+}
+
+/**
+ * @api {get} /pusher/tags/ Get tag list
+ * @apiName GetTagList
+ * @apiGroup Tag
+ *
+ * @apiParam {Number} [size=100] describe how much tags to return, the most used tags first.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/tags/?size=20
+ *
+ * @apiSuccess {Object[]} tags Tag list with the pusher count.
+ * @apiSuccess {Number} other the count of pushers tags which not in the list.
+ * @apiSuccess {Number} size describe how much tags to return.
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "tags": [
+ *         {
+ *           "tag": "friends",
+ *           "count": 1000
+ *         },
+ *         ...
+ *         ...
+ *         ...
+ *       ],
+ *       "other": 0,
+ *       "size": 100
+ *     }
+ *
+ */
+func (s SPusher) handleGetTags(w http.ResponseWriter, req *http.Request) {
+	var qs = req.URL.Query()
+	var err error
+	var size int
+	if size, err = strconv.Atoi(qs.Get("size")); err != nil {
+		size = 100
+	}
+
+	if size > 1000 {
+		size = 1000
+	}
+
+	tags, other, err := s.tagCounts(size)
+	if err != nil {
+		s.reqLogger(req).Error("tagCounts() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	sendJSONResponse(w, http.StatusOK, "", map[string]interface{}{
+		"tags":  tags,
+		"other": other,
+		"size":  size,
+	})
+}
+
+/**
+ * @api {get} /pusher/tags/:tag/pushers/ Get pusher list which has a tag
+ * @apiName GetTagPusherList
+ * @apiGroup Tag
+ *
+ * @apiParam {String} tag some tag.
+ * @apiParam {Number} [from=0] describe how much and which part of the return pusher list
+ * @apiParam {Number} [size=10] describe how much and which part of the return pusher list
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/tags/friends/pushers/?from=0&size=20
+ *
+ * @apiSuccess {String} pushers Pusher object list.
+ * @apiSuccess {Number} total total pushers.
+ * @apiSuccess {Number} from describe how much and which part of the return pusher list
+ * @apiSuccess {Number} size describe how much and which part of the return pusher list
+ * @apiSuccess {String} tag the tag.
+ *
+ */
+func (s SPusher) handleGetTagPushers(w http.ResponseWriter, req *http.Request) {
+	var qs = req.URL.Query()
+	var err error
+	var from, size int
+	var pushers []Pusher
+	var tag = mux.Vars(req)["tag"]
+	if from, err = strconv.Atoi(qs.Get("from")); err != nil {
+		from = 0
+	}
+
+	if size, err = strconv.Atoi(qs.Get("size")); err != nil {
+		size = 10
+	}
+
+	if size > 100 {
+		size = 100
+	}
+
+	searchRequest := bleve.NewSearchRequestOptions(parseQuery(tagQuery(tag)), size, from, false)
+	searchResult, err := s.index.Search(searchRequest)
+	if err != nil {
+		s.reqLogger(req).Error("bleve.Index.Search() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	for _, hit := range searchResult.Hits {
+		p, _ := s.storer.Get(hit.ID)
+		if p.ID == hit.ID {
+			pushers = append(pushers, p)
+		}
+	}
+
+	sendJSONResponse(w, http.StatusOK, "", map[string]interface{}{
+		"pushers": pushers,
+		"total":   searchResult.Total,
+		"from":    from,
+		"size":    size,
+		"tag":     tag,
+	})
+}
+
+/**
+ * @api {post} /pusher/tags/:tag/ Rename a tag on every pusher.
+ * @apiName RenameTag
+ * @apiGroup Tag
+ * @apiDescription Rename to an exists tag will merge the two tags.
+ *
+ * @apiParam {String} tag some tag.
+ * @apiParam {String} to the new tag name.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/tags/friends/ -d to=family
+ *
+ * @apiUse BulkResult
+ *
+ */
+func (s SPusher) handleRenameTag(w http.ResponseWriter, req *http.Request) {
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	var (
+		tag = mux.Vars(req)["tag"]
+		to  = params.Get("to")
+	)
+	if to == "" || to == tag {
+		sendJSONResponse(w, http.StatusNotAcceptable, "err", "to is required and must not be the same tag.")
+		return
+	}
+	job := s.startBulk(BulkJob{Op: BulkRenameTag, Value: tag, To: to, Query: tagQuery(tag)}, nil)
+	sendJSONResponse(w, http.StatusOK, "", map[string]interface{}{"job": job, "result": "OK"})
+}
+
+/**
+ * @api {delete} /pusher/tags/:tag/ Delete a tag from every pusher.
+ * @apiName DeleteTag
+ * @apiGroup Tag
+ *
+ * @apiParam {String} tag some tag.
+ * @apiExample Example usage:
+ * curl -i -XDELETE http://pusher_host/pusher/tags/friends/
+ *
+ * @apiUse BulkResult
+ *
+ */
+func (s SPusher) handleDeleteTag(w http.ResponseWriter, req *http.Request) {
+	var tag = mux.Vars(req)["tag"]
+	job := s.startBulk(BulkJob{Op: BulkRemoveTag, Value: tag, Query: tagQuery(tag)}, nil)
+	sendJSONResponse(w, http.StatusOK, "", map[string]interface{}{"job": job, "result": "OK"})
+}
+
+/**
+ * @apiDefine SenderInfoObject
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "sender": {
+ *         "name": "sendmail",
+ *         "fields": [ "email" ],
+ *         "workers": 2,
+ *         "heartbeat": 1456403493,
+ *         "instances": {
+ *           "host1-4711": 1456403493,
+ *           "host2-4712": 1456403480
+ *         }
+ *       }
+ *     }
+ */
+
+/**
+ * @api {get} /pusher/senders/ Get registered sender list
+ * @apiName GetSenderList
+ * @apiGroup Sender
+ *
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/senders/
+ *
+ * @apiSuccess {Object[]} senders Sender list order by name.
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "senders": [
+ *         {
+ *           "name": "sendmail",
+ *           "fields": [ "email" ],
+ *           "workers": 2,
+ *           "heartbeat": 1456403493
+ *         },
+ *         ...
+ *       ]
+ *     }
+ *
+ */
+func (s SPusher) handleGetSenders(w http.ResponseWriter, req *http.Request) {
+	sendJSONResponse(w, http.StatusOK, "senders", s.senders.all())
+}
+
+/**
+ * @api {get} /pusher/senders/:sender/ Get a registered sender
+ * @apiName GetSender
+ * @apiGroup Sender
+ *
+ * @apiParam {String} sender Sender name.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/senders/sendmail/
+ *
+ * @apiSuccess {Object} sender Sender object.
+ * @apiUse SenderInfoObject
+ * @apiUse SenderNotRegisteredError
+ *
+ */
+func (s SPusher) handleGetSender(w http.ResponseWriter, req *http.Request, sender string) {
+	info, ok := s.senders.get(sender)
+	if !ok {
+		sendJSONResponse(w, http.StatusNotFound, "err", "sender "+sender+" not registered.")
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "sender", info)
+}
+
+/**
+ * @api {post} /pusher/senders/ Announce a sender
+ * @apiName AnnounceSender
+ * @apiGroup Sender
+ * @apiDescription The worker announce the senders on start, then every 30 seconds as heartbeat.
+ *
+ * @apiParam {String} sender Sender name.
+ * @apiParam {String} worker The worker instance unique ID.
+ * @apiParam {String[]=id, email, nickname, phoneNumber} [field] The pusher field required by the sender, repeat the param for each field,
+ * the push to a pusher without it is rejected.
+ * @apiParam {Object} [schema] The json schema of the push data.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/senders/ \
+ *      -d sender=sendmail \
+ *      -d worker=host1-4711 \
+ *      -d field=email \
+ *      -d schema='{"type": "object", "required": ["subject", "text"]}'
+ *
+ * @apiSuccess {Object} sender Sender object.
+ * @apiUse SenderInfoObject
+ *
+ */
+func (s SPusher) handleAnnounceSender(w http.ResponseWriter, req *http.Request) {
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	var info = SenderInfo{
+		Name:   params.Get("sender"),
+		Fields: params.Strings("field"),
+	}
+	var worker = params.Get("worker")
+	if info.Name == "" || worker == "" {
+		sendJSONResponse(w, http.StatusNotAcceptable, "err", "sender and worker is required.")
+		return
+	}
+	for _, field := range info.Fields {
+		if !KnownField(field) {
+			sendJSONResponse(w, http.StatusNotAcceptable, "err", "unknown pusher field "+field+".")
+			return
+		}
+	}
+	if schema := params.Get("schema"); schema != "" {
+		info.Schema = json.RawMessage(schema)
+		if _, err := compileSchema(info.Schema); err != nil {
+			sendJSONResponse(w, http.StatusNotAcceptable, "err", "schema is invalid ("+err.Error()+").")
+			return
+		}
+	}
+	if err := s.senders.announce(info, worker); err != nil {
+		s.reqLogger(req).Error("senderRegistry.announce() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	info, _ = s.senders.get(info.Name)
+	sendJSONResponse(w, http.StatusOK, "sender", info)
+}
+
+/**
+ * @api {delete} /pusher/senders/:sender/ Remove a registered sender
+ * @apiName RemoveRegisteredSender
+ * @apiGroup Sender
+ * @apiDescription The sender will register again on the next worker heartbeat if it still alive.
+ *
+ * @apiParam {String} sender Sender name.
+ * @apiExample Example usage:
+ * curl -i -XDELETE http://pusher_host/pusher/senders/sendmial/
+ *
+ * @apiSuccess {String} result OK.
+ * @apiUse ResultOK
+ *
+ */
+func (s SPusher) handleRemoveRegisteredSender(w http.ResponseWriter, req *http.Request, sender string) {
+	if err := s.senders.remove(sender); err != nil {
+		s.reqLogger(req).Error("senderRegistry.remove() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "result", "OK")
+}
+
+/**
+ * @apiDefine KeyParam
+ * @apiParam {String} [label] The api key label.
+ * @apiParam {String[]=read:pushers, write:pushers, push, pushall, cancel, admin} [scopes] The api key scopes.
+ * @apiParam {String[]} [senders] The allowed senders, empty is allow all senders.
+ * @apiParam {Number} [expiresAt] The api key expires unix time, 0 is never expires.
+ * @apiParam {String} [tenant] The api key tenant, empty is the default tenant.
+ * @apiParam {Object} [rateLimits] The rate limit per route class, eg: <code>{"push": {"rate": 10, "burst": 20}}</code>.
+ */
+
+/**
+ * @apiDefine KeyObject
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "key": {
+ *         "key": "0f8e3c2b1a6d4e59",
+ *         "label": "mail service",
+ *         "scopes": [ "read:pushers", "push" ],
+ *         "senders": [ "sendmail" ],
+ *         "expiresAt": 0,
+ *         "revoked": false,
+ *         "createdAt": 1456403493
+ *       }
+ *     }
+ */
+
+/**
+ * @apiDefine KeyNotFoundError
+ * @apiError {String} err api key <code>key</code> not exists.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 404 Not Found
+ *     {
+ *       "err": "api key 0f8e3c2b1a6d4e59 not exists."
+ *     }
+ */
+
+// bindKey read the api key params, reply not acceptable if a scope is unknown
+func bindKey(w http.ResponseWriter, req *http.Request, k *APIKey) bool {
+	params, ok := parseParams(w, req)
+	if !ok {
+		return false
+	}
+	if params.Has("label") {
+		k.Label = params.Get("label")
+	}
+	if params.Has("scopes") {
+		k.Scopes = params.Strings("scopes")
+		for _, scope := range k.Scopes {
+			if !validScope(scope) {
+				sendJSONResponse(w, http.StatusNotAcceptable, "err", "unknown scope "+scope+".")
+				return false
+			}
+		}
+	}
+	if params.Has("senders") {
+		k.Senders = params.Strings("senders")
+	}
+	if params.Has("expiresAt") {
+		k.ExpiresAt, _ = strconv.ParseInt(params.Get("expiresAt"), 10, 64)
+	}
+	if params.Has("rateLimits") {
+		k.RateLimits = nil
+		if err := json.Unmarshal([]byte(params.Get("rateLimits")), &k.RateLimits); err != nil {
+			sendJSONResponse(w, http.StatusNotAcceptable, "err", "invalid rateLimits ("+err.Error()+").")
+			return false
+		}
+	}
+	if params.Has("tenant") {
+		k.Tenant = params.Get("tenant")
+		if !validTenant(k.Tenant) {
+			sendJSONResponse(w, http.StatusNotAcceptable, "err", "invalid tenant "+k.Tenant+".")
+			return false
+		}
+	}
+	return true
+}
+
+/**
+ * @api {get} /pusher/keys/ Get api key list
+ * @apiName GetKeyList
+ * @apiGroup Key
+ * @apiPermission admin
+ *
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/keys/
+ *
+ * @apiSuccess {Object[]} keys Api key list without the secret.
+ *
+ */
+func (s SPusher) handleGetKeys(w http.ResponseWriter, req *http.Request) {
+	var keys = s.keys.all()
+	for i := range keys {
+		keys[i].Secret = ""
+	}
+	sendJSONResponse(w, http.StatusOK, "keys", keys)
+}
+
+/**
+ * @api {post} /pusher/keys/ Create an api key
+ * @apiName CreateKey
+ * @apiGroup Key
+ * @apiPermission admin
+ * @apiDescription The secret is only returned on create.
+ *
+ * @apiUse KeyParam
+ * @apiUse JSONBody
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/keys/ \
+ *      -d label='mail service' \
+ *      -d scopes=read:pushers \
+ *      -d scopes=push \
+ *      -d senders=sendmail
+ *
+ * @apiSuccess {Object} key Api key object with the secret.
+ * @apiUse KeyObject
+ *
+ */
+func (s SPusher) handleCreateKey(w http.ResponseWriter, req *http.Request) {
+	var k = APIKey{
+		Key:       randomHex(8),
+		Secret:    randomHex(16),
+		CreatedAt: time.Now().Unix(),
+	}
+	if !bindKey(w, req, &k) {
+		return
+	}
+	if err := s.keys.set(k); err != nil {
+		s.reqLogger(req).Error("keyStore.set() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "key", k)
+}
+
+/**
+ * @api {get} /pusher/keys/:key/ Get an api key
+ * @apiName GetKey
+ * @apiGroup Key
+ * @apiPermission admin
+ *
+ * @apiParam {String} key The api key.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/keys/0f8e3c2b1a6d4e59/
+ *
+ * @apiSuccess {Object} key Api key object without the secret.
+ * @apiUse KeyObject
+ * @apiUse KeyNotFoundError
+ *
+ */
+func (s SPusher) handleGetKey(w http.ResponseWriter, req *http.Request) {
+	var key = mux.Vars(req)["key"]
+	k, ok := s.keys.get(key)
+	if !ok {
+		sendJSONResponse(w, http.StatusNotFound, "err", "api key "+key+" not exists.")
+		return
+	}
+	k.Secret = ""
+	sendJSONResponse(w, http.StatusOK, "key", k)
+}
+
+/**
+ * @api {post} /pusher/keys/:key/ Update an api key
+ * @apiName UpdateKey
+ * @apiGroup Key
+ * @apiPermission admin
+ *
+ * @apiParam {String} key The api key.
+ * @apiUse KeyParam
+ * @apiUse JSONBody
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/keys/0f8e3c2b1a6d4e59/ \
+ *      -d expiresAt=1456403493
+ *
+ * @apiSuccess {Object} key Api key object without the secret.
+ * @apiUse KeyObject
+ * @apiUse KeyNotFoundError
+ *
+ */
+func (s SPusher) handleUpdateKey(w http.ResponseWriter, req *http.Request) {
+	var key = mux.Vars(req)["key"]
+	k, ok := s.keys.get(key)
+	if !ok {
+		sendJSONResponse(w, http.StatusNotFound, "err", "api key "+key+" not exists.")
+		return
+	}
+	if !bindKey(w, req, &k) {
+		return
+	}
+	if err := s.keys.set(k); err != nil {
+		s.reqLogger(req).Error("keyStore.set() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	k.Secret = ""
+	sendJSONResponse(w, http.StatusOK, "key", k)
+}
+
+/**
+ * @api {post} /pusher/keys/:key/revoke Revoke an api key
+ * @apiName RevokeKey
+ * @apiGroup Key
+ * @apiPermission admin
+ *
+ * @apiParam {String} key The api key.
+ * @apiExample Example usage:
+ * curl -i -XPOST http://pusher_host/pusher/keys/0f8e3c2b1a6d4e59/revoke
+ *
+ * @apiSuccess {String} result OK.
+ * @apiUse ResultOK
+ * @apiUse KeyNotFoundError
+ *
+ */
+func (s SPusher) handleRevokeKey(w http.ResponseWriter, req *http.Request) {
+	var key = mux.Vars(req)["key"]
+	k, ok := s.keys.get(key)
+	if !ok {
+		sendJSONResponse(w, http.StatusNotFound, "err", "api key "+key+" not exists.")
+		return
+	}
+	k.Revoked = true
+	if err := s.keys.set(k); err != nil {
+		s.reqLogger(req).Error("keyStore.set() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "result", "OK")
+}
+
+/**
+ * @api {delete} /pusher/keys/:key/ Remove an api key
+ * @apiName RemoveKey
+ * @apiGroup Key
+ * @apiPermission admin
+ *
+ * @apiParam {String} key The api key.
+ * @apiExample Example usage:
+ * curl -i -XDELETE http://pusher_host/pusher/keys/0f8e3c2b1a6d4e59/
+ *
+ * @apiSuccess {String} result OK.
+ * @apiUse ResultOK
+ *
+ */
+func (s SPusher) handleRemoveKey(w http.ResponseWriter, req *http.Request) {
+	if err := s.keys.del(mux.Vars(req)["key"]); err != nil {
+		s.reqLogger(req).Error("keyStore.del() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "result", "OK")
+}
+
+/**
+ * @api {post} /pusher/caps/:sender/ Take the frequency caps of a pusher
+ * @apiName TakeCap
+ * @apiGroup Cap
+ * @apiPermission admin
+ * @apiDescription The worker take the caps before send, a push is counted only when all the caps are not exceeded,
+ * the worker refund it when the push is not delivered.
+ *
+ * @apiUse SenderParam
+ * @apiParam {String[]} cap The caps as <code>max/seconds</code>, eg: <code>3/3600</code> is at most 3 pushes an hour.
+ * @apiUse JSONBody
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/caps/sendsms/ \
+ *      -d pusher=lupino \
+ *      -d cap=3/3600 \
+ *      -d cap=10/86400
+ *
+ * @apiSuccess {Boolean} allowed The push is allowed.
+ * @apiSuccess {String} cap The exceeded cap.
+ * @apiSuccess {Number} retryAfter The seconds until the exceeded cap window end.
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "allowed": false,
+ *       "cap": "3/3600",
+ *       "retryAfter": 1200
+ *     }
+ *
+ */
+func (s SPusher) handleTakeCap(w http.ResponseWriter, req *http.Request, sender string) {
+	pusher, caps, ok := bindCaps(w, req)
+	if !ok {
+		return
+	}
+	ret, err := s.caps.take(utils.JoinTenant(s.tenant, pusher), sender, caps)
+	if err != nil {
+		s.reqLogger(req).Error("capCounters.take() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "", ret)
+}
+
+/**
+ * @api {post} /pusher/caps/:sender/refund Refund the frequency caps of a pusher
+ * @apiName RefundCap
+ * @apiGroup Cap
+ * @apiPermission admin
+ * @apiDescription The worker refund the push taken by TakeCap when it is not delivered, eg: retry later,
+ * the push taken in the windows which already ended is not refunded.
+ *
+ * @apiUse SenderParam
+ * @apiParam {String[]} cap The caps as <code>max/seconds</code>, same as TakeCap.
+ * @apiUse JSONBody
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/caps/sendsms/refund \
+ *      -d pusher=lupino \
+ *      -d cap=3/3600
+ *
+ * @apiUse ResultOK
+ *
+ */
+func (s SPusher) handleRefundCap(w http.ResponseWriter, req *http.Request, sender string) {
+	pusher, caps, ok := bindCaps(w, req)
+	if !ok {
+		return
+	}
+	if err := s.caps.refund(utils.JoinTenant(s.tenant, pusher), sender, caps); err != nil {
+		s.reqLogger(req).Error("capCounters.refund() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "result", "OK")
+}
+
+// bindCaps read the pusher and the caps params
+func bindCaps(w http.ResponseWriter, req *http.Request) (pusher string, caps []Cap, ok bool) {
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	if pusher = params.Get("pusher"); pusher == "" {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "pusher is required.")
+		return "", nil, false
+	}
+	for _, str := range params.Strings("cap") {
+		c, err := ParseCap(str)
+		if err != nil {
+			sendJSONResponse(w, http.StatusUnprocessableEntity, "err", err.Error()+".")
+			return "", nil, false
+		}
+		caps = append(caps, c)
+	}
+	return pusher, caps, true
+}
+
+/**
+ * @apiDefine DeliveryStatusObject
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "status": {
+ *         "name": "lupino_0f8e3c2b1a6d4e59",
+ *         "sender": "sendsms",
+ *         "pusher": "lupino",
+ *         "status": "deferred",
+ *         "reason": "cap 3/3600 exceeded",
+ *         "counter": 0,
+ *         "updatedAt": 1456403493
+ *       }
+ *     }
+ */
+
+/**
+ * @api {post} /pusher/:sender/status Report the delivery status of a push
+ * @apiName SetDeliveryStatus
+ * @apiGroup Push
+ * @apiPermission admin
+ * @apiDescription The worker report the delivery decision of a job, the status is kept seven days.
+ *
+ * @apiParam {String=sendmail, sendsms, customSenderName} sender Sender name.
+ * @apiParam {String} name The periodic job name.
+ * @apiParam {String} pusher Pusher unique ID.
+ * @apiParam {String=sent, failed, retry, dropped, deferred, expired} status The delivery status.
+ * @apiParam {String} [reason] Why the job is failed, dropped or deferred.
+ * @apiParam {Number} [counter] The job run counter.
+ * @apiParam {Number} [offset] The pushers already handled by a pushall job, it resume from the offset.
+ * @apiParam {Number} [failed] The pushers failed to push by a pushall job.
+ * @apiUse JSONBody
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/sendsms/status \
+ *      -d name=lupino_0f8e3c2b1a6d4e59 \
+ *      -d pusher=lupino \
+ *      -d status=deferred \
+ *      -d reason='cap 3/3600 exceeded'
+ *
+ * @apiSuccess {String} result OK.
+ * @apiUse ResultOK
+ *
+ */
+func (s SPusher) handleSetDeliveryStatus(w http.ResponseWriter, req *http.Request, sender string) {
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	var status = DeliveryStatus{
+		Name:      params.Get("name"),
+		Sender:    sender,
+		Pusher:    params.Get("pusher"),
+		Status:    params.Get("status"),
+		Reason:    params.Get("reason"),
+		UpdatedAt: time.Now().Unix(),
+	}
+	status.Counter, _ = strconv.Atoi(params.Get("counter"))
+	status.Offset, _ = strconv.Atoi(params.Get("offset"))
+	status.Failed, _ = strconv.Atoi(params.Get("failed"))
+	if status.Name == "" || status.Status == "" {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "name and status is required.")
+		return
+	}
+	if tenant, _ := utils.SplitTenant(status.Name); tenant != s.tenant {
+		sendJSONResponse(w, http.StatusForbidden, "err", "job "+status.Name+" is not in the tenant.")
+		return
+	}
+	if err := s.status.set(status); err != nil {
+		s.reqLogger(req).Error("deliveryStore.set() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "result", "OK")
+}
+
+/**
+ * @api {get} /pusher/:sender/status Get the delivery status of a push
+ * @apiName GetDeliveryStatus
+ * @apiGroup Push
+ *
+ * @apiParam {String=pushall, sendmail, sendsms, customSenderName} sender Sender name.
+ * @apiParam {String} name The periodic job name.
+ * @apiExample Example usage:
+ * curl -i 'http://pusher_host/pusher/sendsms/status?name=lupino_0f8e3c2b1a6d4e59'
+ *
+ * @apiSuccess {Object} status Delivery status object.
+ * @apiUse DeliveryStatusObject
+ *
+ * @apiError {String} err delivery status of job <code>name</code> not exists.
+ *
+ */
+func (s SPusher) handleGetDeliveryStatus(w http.ResponseWriter, req *http.Request, sender string) {
+	var name = req.URL.Query().Get("name")
+	if tenant, _ := utils.SplitTenant(name); tenant != s.tenant {
+		sendJSONResponse(w, http.StatusForbidden, "err", "job "+name+" is not in the tenant.")
+		return
+	}
+	status, ok, err := s.status.get(sender, name)
+	if err != nil {
+		s.reqLogger(req).Error("deliveryStore.get() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		sendJSONResponse(w, http.StatusNotFound, "err", "delivery status of job "+name+" not exists.")
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "status", status)
+}
+
+/**
+ * @apiDefine DeadLetterObject
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "letter": {
+ *         "id": "lupino_0f8e3c2b1a6d4e59",
+ *         "sender": "sendsms",
+ *         "pusher": "lupino",
+ *         "data": "{\"signName\": \"sign\", \"template\": \"template\"}",
+ *         "err": "max attempts (isv.BUSINESS_LIMIT_CONTROL)",
+ *         "history": [
+ *           {
+ *             "status": "retry",
+ *             "reason": "isv.BUSINESS_LIMIT_CONTROL",
+ *             "counter": 0,
+ *             "at": 1456403493
+ *           },
+ *           ...
+ *         ],
+ *         "createdAt": 1456403593
+ *       }
+ *     }
+ */
+
+/**
+ * @apiDefine DeadLetterNotFoundError
+ * @apiError {String} err dead letter <code>id</code> not exists.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 404 Not Found
+ *     {
+ *       "err": "dead letter lupino_0f8e3c2b1a6d4e59 not exists."
+ *     }
+ */
+
+/**
+ * @api {post} /pusher/deadletters/ Add a dead letter
+ * @apiName AddDeadLetter
+ * @apiGroup DeadLetter
+ * @apiPermission admin
+ * @apiDescription The worker add the job which exhausted the attempts or failed permanently,
+ * the delivery history is copied from the delivery status.
+ *
+ * @apiParam {String} name The periodic job name.
+ * @apiParam {String} sender Sender name.
+ * @apiParam {String} pusher Pusher unique ID, or the sender of a pushall job.
+ * @apiParam {String} data The push data.
+ * @apiParam {String=high, normal, low} [priority=normal] the priority of the push.
+ * @apiParam {Number} [expiresAt] the unix time the push is useless.
+ * @apiParam {Object} [meta] the metadata of the push, a json object of strings.
+ * @apiParam {String} [err] The last error.
+ * @apiUse JSONBody
+ *
+ * @apiSuccess {String} result OK.
+ * @apiUse ResultOK
+ *
+ */
+func (s SPusher) handleAddDeadLetter(w http.ResponseWriter, req *http.Request) {
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	var name = params.Get("name")
+	tenant, id := utils.SplitTenant(name)
+	if tenant != s.tenant {
+		sendJSONResponse(w, http.StatusForbidden, "err", "job "+name+" is not in the tenant.")
+		return
+	}
+	var letter = DeadLetter{
+		ID:        id,
+		Sender:    params.Get("sender"),
+		Pusher:    params.Get("pusher"),
+		Data:      params.Get("data"),
+		Priority:  params.Get("priority"),
+		Err:       params.Get("err"),
+		CreatedAt: time.Now().Unix(),
+	}
+	letter.ExpiresAt, _ = strconv.ParseInt(params.Get("expiresAt"), 10, 64)
+	if letter.Meta, ok = bindMeta(w, params); !ok {
+		return
+	}
+	if letter.ID == "" || letter.Sender == "" || letter.Pusher == "" {
+		sendJSONResponse(w, http.StatusUnprocessableEntity, "err", "name, sender and pusher is required.")
+		return
+	}
+	if status, ok, _ := s.status.get(letter.Sender, name); ok {
+		letter.History = status.History
+	}
+	if err := s.letters.add(s.tenant, letter); err != nil {
+		s.reqLogger(req).Error("deadLetterStore.add() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "result", "OK")
+}
+
+/**
+ * @api {get} /pusher/deadletters/ Get dead letter list
+ * @apiName GetDeadLetterList
+ * @apiGroup DeadLetter
+ *
+ * @apiParam {String} [sender] Only the dead letters of the sender.
+ * @apiParam {Number} [from=0] describe how much and which part of the return list
+ * @apiParam {Number} [size=10] describe how much and which part of the return list
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/deadletters/?sender=sendsms&from=0&size=20
+ *
+ * @apiSuccess {Object[]} letters Dead letter list, the newest first.
+ * @apiSuccess {Number} total total dead letters.
+ * @apiSuccess {Number} from describe how much and which part of the return list
+ * @apiSuccess {Number} size describe how much and which part of the return list
+ *
+ */
+func (s SPusher) handleGetDeadLetters(w http.ResponseWriter, req *http.Request) {
+	var qs = req.URL.Query()
+	var err error
+	var from, size int
+	if from, err = strconv.Atoi(qs.Get("from")); err != nil || from < 0 {
+		from = 0
+	}
+
+	if size, err = strconv.Atoi(qs.Get("size")); err != nil || size < 0 {
+		size = 10
+	}
+
+	if size > 100 {
+		size = 100
+	}
+
+	letters, err := s.letters.list(s.tenant, qs.Get("sender"))
+	if err != nil {
+		s.reqLogger(req).Error("deadLetterStore.list() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	var total = len(letters)
+	if from > total {
+		from = total
+	}
+	var end = from + size
+	if end > total {
+		end = total
+	}
+
+	sendJSONResponse(w, http.StatusOK, "", map[string]interface{}{
+		"letters": letters[from:end],
+		"total":   total,
+		"from":    from,
+		"size":    size,
+	})
+}
+
+/**
+ * @api {get} /pusher/deadletters/:id/ Get a dead letter
+ * @apiName GetDeadLetter
+ * @apiGroup DeadLetter
+ *
+ * @apiParam {String} id The periodic job name without the tenant.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/deadletters/lupino_0f8e3c2b1a6d4e59/
+ *
+ * @apiSuccess {Object} letter Dead letter object.
+ * @apiUse DeadLetterObject
+ * @apiUse DeadLetterNotFoundError
+ *
+ */
+func (s SPusher) handleGetDeadLetter(w http.ResponseWriter, req *http.Request) {
+	var id = mux.Vars(req)["id"]
+	letter, ok, err := s.letters.get(s.tenant, id)
+	if err != nil {
+		s.reqLogger(req).Error("deadLetterStore.get() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		sendJSONResponse(w, http.StatusNotFound, "err", "dead letter "+id+" not exists.")
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "letter", letter)
+}
+
+/**
+ * @api {post} /pusher/deadletters/:id/replay Replay a dead letter
+ * @apiName ReplayDeadLetter
+ * @apiGroup DeadLetter
+ * @apiDescription Resubmit the dead letter with the same sender, pusher, data, priority, expiry and meta,
+ * then remove it from the dead letters. The push use the sender quota,
+ * the expired dead letter is refused and kept until purged.
+ *
+ * @apiParam {String} id The periodic job name without the tenant.
+ * @apiExample Example usage:
+ * curl -i -XPOST http://pusher_host/pusher/deadletters/lupino_0f8e3c2b1a6d4e59/replay
+ *
+ * @apiSuccess {String} result OK.
+ * @apiSuccess {String} name The periodic job name.
+ * @apiUse PushResult
+ * @apiUse DeadLetterNotFoundError
+ * @apiError {String} err dead letter <code>id</code> is expired.
+ * @apiErrorExample Response (example):
+ *     HTTP/1.1 410 Gone
+ *     {
+ *       "err": "dead letter lupino_0f8e3c2b1a6d4e59 is expired."
+ *     }
+ *
+ */
+func (s SPusher) handleReplayDeadLetter(w http.ResponseWriter, req *http.Request) {
+	var id = mux.Vars(req)["id"]
+	letter, ok, err := s.letters.get(s.tenant, id)
+	if err != nil {
+		s.reqLogger(req).Error("deadLetterStore.get() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		sendJSONResponse(w, http.StatusNotFound, "err", "dead letter "+id+" not exists.")
+		return
+	}
+	if !allowSender(w, req, letter.Sender) {
+		return
+	}
+	// the pusher of a pushall job is the sender, the pushes use the quota
+	var sender, n = letter.Sender, int64(1)
+	if letter.Sender == "pushall" {
+		sender, n = letter.Pusher, 0
+		if !allowSender(w, req, sender) {
+			return
+		}
+	}
+	if letter.ExpiresAt > 0 && letter.ExpiresAt <= time.Now().Unix() {
+		sendJSONResponse(w, http.StatusGone, "err", "dead letter "+id+" is expired.")
+		return
+	}
+	if !s.checkQuota(w, req, sender, n) {
+		return
+	}
+	var name string
+	var payload = utils.Payload{Data: letter.Data, ExpiresAt: letter.ExpiresAt, Meta: letter.Meta, Trace: tracing.Inject(req.Context(), nil)}
+	if name, err = s.push(letter.Sender, letter.Pusher, payload, "", letter.Priority); err != nil {
+		s.reqLogger(req).Error("push() failed", "err", err)
+		s.refundQuota(req, sender, n)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if err = s.letters.remove(s.tenant, id); err != nil {
+		s.reqLogger(req).Error("deadLetterStore.remove() failed", "err", err)
+	}
+	sendJSONResponse(w, http.StatusOK, "", map[string]string{"name": name, "result": "OK"})
+}
+
+/**
+ * @api {delete} /pusher/deadletters/:id/ Purge a dead letter
+ * @apiName PurgeDeadLetter
+ * @apiGroup DeadLetter
+ *
+ * @apiParam {String} id The periodic job name without the tenant.
+ * @apiExample Example usage:
+ * curl -i -XDELETE http://pusher_host/pusher/deadletters/lupino_0f8e3c2b1a6d4e59/
+ *
+ * @apiSuccess {String} result OK.
+ * @apiUse ResultOK
+ *
+ */
+func (s SPusher) handlePurgeDeadLetter(w http.ResponseWriter, req *http.Request) {
+	if err := s.letters.remove(s.tenant, mux.Vars(req)["id"]); err != nil {
+		s.reqLogger(req).Error("deadLetterStore.remove() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "result", "OK")
+}
+
+/**
+ * @api {delete} /pusher/deadletters/ Purge the dead letters
+ * @apiName PurgeDeadLetters
+ * @apiGroup DeadLetter
+ *
+ * @apiParam {String} [sender] Only purge the dead letters of the sender.
+ * @apiExample Example usage:
+ * curl -i -XDELETE http://pusher_host/pusher/deadletters/?sender=sendsms
+ *
+ * @apiSuccess {String} result OK.
+ * @apiSuccess {Number} purged The count of the purged dead letters.
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "purged": 10,
+ *       "result": "OK"
+ *     }
+ *
+ */
+func (s SPusher) handlePurgeDeadLetters(w http.ResponseWriter, req *http.Request) {
+	purged, err := s.letters.purge(s.tenant, req.URL.Query().Get("sender"))
+	if err != nil {
+		s.reqLogger(req).Error("deadLetterStore.purge() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "", map[string]interface{}{"purged": purged, "result": "OK"})
+}
+
+/**
+ * @apiDefine QuotaParam
+ * @apiParam {String=sendmail, sendsms, customSenderName} sender Sender name.
+ * @apiParam {Number} [daily=0] The max pushes a day, 0 is unlimited.
+ * @apiParam {Number} [monthly=0] The max pushes a month, 0 is unlimited.
+ */
+
+/**
+ * @api {get} /pusher/quotas/ Get the sender quota list
+ * @apiName GetQuotaList
+ * @apiGroup Quota
+ * @apiDescription The quotas of the request tenant, the counters reset in UTC.
+ *
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/quotas/
+ *
+ * @apiSuccess {Object[]} quotas Quota list order by sender.
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "quotas": [
+ *         {
+ *           "sender": "sendsms",
+ *           "daily": 1000,
+ *           "monthly": 20000,
+ *           "day": "2016-02-25",
+ *           "dayUsed": 120,
+ *           "month": "2016-02",
+ *           "monthUsed": 5230
+ *         }
+ *       ]
+ *     }
+ *
+ */
+func (s SPusher) handleGetQuotas(w http.ResponseWriter, req *http.Request) {
+	sendJSONResponse(w, http.StatusOK, "quotas", s.quotas.all(s.tenant))
+}
+
+/**
+ * @api {post} /pusher/quotas/:sender/ Set the sender quota
+ * @apiName SetQuota
+ * @apiGroup Quota
+ * @apiPermission admin
+ * @apiDescription Set the quota of the request tenant, the push beyond the quota reply 429.
+ * A pushall is rejected when no push is left, the worker push to every pusher of it use the quota one by one.
+ *
+ * @apiUse QuotaParam
+ * @apiUse JSONBody
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/quotas/sendsms/ \
+ *      -d daily=1000 \
+ *      -d monthly=20000
+ *
+ * @apiSuccess {Object} quota Quota object.
+ *
+ */
+func (s SPusher) handleSetQuota(w http.ResponseWriter, req *http.Request, sender string) {
+	params, ok := parseParams(w, req)
+	if !ok {
+		return
+	}
+	daily, _ := strconv.ParseInt(params.Get("daily"), 10, 64)
+	monthly, _ := strconv.ParseInt(params.Get("monthly"), 10, 64)
+	q, err := s.quotas.set(s.tenant, sender, daily, monthly)
+	if err != nil {
+		s.reqLogger(req).Error("quotaStore.set() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "quota", q)
+}
+
+/**
+ * @api {delete} /pusher/quotas/:sender/ Remove the sender quota
+ * @apiName RemoveQuota
+ * @apiGroup Quota
+ * @apiPermission admin
+ *
+ * @apiParam {String=sendmail, sendsms, customSenderName} sender Sender name.
+ * @apiExample Example usage:
+ * curl -i -XDELETE http://pusher_host/pusher/quotas/sendsms/
+ *
+ * @apiSuccess {String} result OK.
+ * @apiUse ResultOK
+ *
+ */
+func (s SPusher) handleRemoveQuota(w http.ResponseWriter, req *http.Request, sender string) {
+	if err := s.quotas.remove(s.tenant, sender); err != nil {
+		s.reqLogger(req).Error("quotaStore.remove() failed", "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	sendJSONResponse(w, http.StatusOK, "result", "OK")
+}
+
+func wapperPusherHandle(handle func(http.ResponseWriter, *http.Request, string)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		vars := mux.Vars(req)
+		pusher := vars["pusher"]
+		handle(w, req, pusher)
+	}
+}
+
+func wapperTagHandle(handle func(http.ResponseWriter, *http.Request, string, string)) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, req *http.Request) {
+		vars := mux.Vars(req)
+		pusher := vars["pusher"]
+		tag := vars["tag"]
+		handle(w, req, pusher, tag)
+	}
+}
+
+/**
+ * @api {get} /pusher/changes/ Get the changed pushers
+ * @apiName GetChanges
+ * @apiGroup Pusher
+ *
+ * @apiParam {String} [epoch] The epoch of the last changes.
+ * @apiParam {Number} [seq] The seq of the last changes.
+ * @apiExample Example usage:
+ * curl -i http://pusher_host/pusher/changes/?epoch=0f8e3c2b1a6d4e59&seq=1024
+ *
+ * @apiSuccess {Object} changes The pushers of every tenant changed since the seq,
+ * reset is true when the changes are lost, eg: the server restarted.
+ * @apiSuccessExample {json} Success-Response:
+ *     HTTP/1.1 200 OK
+ *     {
+ *       "changes": {
+ *         "epoch": "0f8e3c2b1a6d4e59",
+ *         "seq": 1026,
+ *         "reset": false,
+ *         "pushers": [ "lupino", "acme/4711" ]
+ *       }
+ *     }
+ *
+ */
+func (s SPusher) handleGetChanges(w http.ResponseWriter, req *http.Request) {
+	var query = req.URL.Query()
+	seq, _ := strconv.ParseUint(query.Get("seq"), 10, 64)
+	sendJSONResponse(w, http.StatusOK, "changes", s.changes.since(query.Get("epoch"), seq))
+}
+
+// NewRouter return new pusher router, the request is dispatched to the router of its tenant
+func (s SPusher) NewRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.PathPrefix("/").HandlerFunc(s.handleTenant)
+	return router
+}
+
+// newRouter the router of a tenant
+func (s SPusher) newRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(s.instrument, s.trace, s.routeLogger)
+	router.HandleFunc("/pusher/pushers/{pusher}/", s.scope(ScopeReadPushers, wapperPusherHandle(s.handleGetPusher))).Methods("GET")
+	router.HandleFunc("/pusher/pushers/", s.scope(ScopeReadPushers, s.handleGetAllPusher)).Methods("GET")
+	router.HandleFunc("/pusher/search/", s.scope(ScopeReadPushers, s.handleSearchPusher)).Methods("GET")
+	router.HandleFunc("/pusher/changes/", s.scope(ScopeAdmin, s.handleGetChanges)).Methods("GET")
+
+	router.HandleFunc("/pusher/pushers/", s.scope(ScopeWritePushers, s.handleAddPusher)).Methods("POST")
+	router.HandleFunc("/pusher/pushers/{pusher}/", s.scope(ScopeWritePushers, wapperPusherHandle(s.handleRemovePusher))).Methods("DELETE")
+	router.HandleFunc("/pusher/pushers/{pusher}/", s.scope(ScopeWritePushers, wapperPusherHandle(s.handleUpdatePusher))).Methods("POST")
+
+	router.HandleFunc("/pusher/pushers/{pusher}/{tag}/", s.scope(ScopeWritePushers, wapperTagHandle(s.handleRemoveTag))).Methods("DELETE")
+	router.HandleFunc("/pusher/pushers/{pusher}/{tag}/", s.scope(ScopeWritePushers, wapperTagHandle(s.handleAddTag))).Methods("POST")
+
+	router.HandleFunc("/pusher/{sender}/add", s.scope(ScopeWritePushers, wapperSenderHandle(s.handleAddSender))).Methods("POST")
+	router.HandleFunc("/pusher/{sender}/delete", s.scope(ScopeWritePushers, wapperSenderHandle(s.handleRemoveSender))).Methods("POST")
+
+	router.HandleFunc("/pusher/{sender}/push", s.scope(ScopePush, wapperSenderHandle(s.handlePush))).Methods("POST")
+	router.HandleFunc("/pusher/{sender}/cancelpush", s.scope(ScopeCancel, wapperSenderHandle(s.handleCancelPush))).Methods("POST")
+	router.HandleFunc("/pusher/{sender}/pushall", s.scope(ScopePushAll, wapperSenderHandle(s.handlePushAll))).Methods("POST")
+	router.HandleFunc("/pusher/{sender}/status", s.scope(ScopeReadPushers, wapperSenderHandle(s.handleGetDeliveryStatus))).Methods("GET")
+	router.HandleFunc("/pusher/{sender}/status", s.scope(ScopeAdmin, wapperSenderHandle(s.handleSetDeliveryStatus))).Methods("POST")
+	router.HandleFunc("/pusher/caps/{sender}/", s.scope(ScopeAdmin, wapperSenderHandle(s.handleTakeCap))).Methods("POST")
+	router.HandleFunc("/pusher/caps/{sender}/refund", s.scope(ScopeAdmin, wapperSenderHandle(s.handleRefundCap))).Methods("POST")
+
+	router.HandleFunc("/pusher/bulk/tags/{tag}/add", s.scope(ScopeWritePushers, s.handleBulkAddTag)).Methods("POST")
+	router.HandleFunc("/pusher/bulk/tags/{tag}/delete", s.scope(ScopeWritePushers, s.handleBulkRemoveTag)).Methods("POST")
+	router.HandleFunc("/pusher/bulk/{sender}/add", s.scope(ScopeWritePushers, wapperSenderHandle(s.handleBulkAddSender))).Methods("POST")
+	router.HandleFunc("/pusher/bulk/{sender}/delete", s.scope(ScopeWritePushers, wapperSenderHandle(s.handleBulkRemoveSender))).Methods("POST")
+	router.HandleFunc("/pusher/bulk/jobs/", s.scope(ScopeReadPushers, s.handleGetBulkJobs)).Methods("GET")
+	router.HandleFunc("/pusher/bulk/jobs/{job}/", s.scope(ScopeReadPushers, s.handleGetBulkJob)).Methods("GET")
+
+	router.HandleFunc("/pusher/senders/", s.scope(ScopeReadPushers, s.handleGetSenders)).Methods("GET")
+	router.HandleFunc("/pusher/senders/", s.scope(ScopeAdmin, s.handleAnnounceSender)).Methods("POST")
+	router.HandleFunc("/pusher/senders/{sender}/", s.scope(ScopeReadPushers, wapperSenderHandle(s.handleGetSender))).Methods("GET")
+	router.HandleFunc("/pusher/senders/{sender}/", s.scope(ScopeAdmin, wapperSenderHandle(s.handleRemoveRegisteredSender))).Methods("DELETE")
 
-	router.HandleFunc("/pusher/pushers/", s.handleAddPusher).Methods("POST")
-	router.HandleFunc("/pusher/pushers/{pusher}/", wapperPusherHandle(s.handleRemovePusher)).Methods("DELETE")
-	router.HandleFunc("/pusher/pushers/{pusher}/", wapperPusherHandle(s.handleUpdatePusher)).Methods("POST")
+	router.HandleFunc("/pusher/tags/", s.scope(ScopeReadPushers, s.handleGetTags)).Methods("GET")
+	router.HandleFunc("/pusher/tags/{tag}/pushers/", s.scope(ScopeReadPushers, s.handleGetTagPushers)).Methods("GET")
+	router.HandleFunc("/pusher/tags/{tag}/", s.scope(ScopeWritePushers, s.handleRenameTag)).Methods("POST")
+	router.HandleFunc("/pusher/tags/{tag}/", s.scope(ScopeWritePushers, s.handleDeleteTag)).Methods("DELETE")
 
-	router.HandleFunc("/pusher/pushers/{pusher}/{tag}/", wapperTagHandle(s.handleRemoveTag)).Methods("DELETE")
-	router.HandleFunc("/pusher/pushers/{pusher}/{tag}/", wapperTagHandle(s.handleAddTag)).Methods("POST")
+	router.HandleFunc("/pusher/keys/", s.scope(ScopeAdmin, s.handleGetKeys)).Methods("GET")
+	router.HandleFunc("/pusher/keys/", s.scope(ScopeAdmin, s.handleCreateKey)).Methods("POST")
+	router.HandleFunc("/pusher/keys/{key}/", s.scope(ScopeAdmin, s.handleGetKey)).Methods("GET")
+	router.HandleFunc("/pusher/keys/{key}/", s.scope(ScopeAdmin, s.handleUpdateKey)).Methods("POST")
+	router.HandleFunc("/pusher/keys/{key}/", s.scope(ScopeAdmin, s.handleRemoveKey)).Methods("DELETE")
+	router.HandleFunc("/pusher/keys/{key}/revoke", s.scope(ScopeAdmin, s.handleRevokeKey)).Methods("POST")
 
-	router.HandleFunc("/pusher/{sender}/add", wapperSenderHandle(s.handleAddSender)).Methods("POST")
-	router.HandleFunc("/pusher/{sender}/delete", wapperSenderHandle(s.handleRemoveSender)).Methods("POST")
+	router.HandleFunc("/pusher/deadletters/", s.scope(ScopeReadPushers, s.handleGetDeadLetters)).Methods("GET")
+	router.HandleFunc("/pusher/deadletters/", s.scope(ScopeAdmin, s.handleAddDeadLetter)).Methods("POST")
+	router.HandleFunc("/pusher/deadletters/", s.scope(ScopeCancel, s.handlePurgeDeadLetters)).Methods("DELETE")
+	router.HandleFunc("/pusher/deadletters/{id}/", s.scope(ScopeReadPushers, s.handleGetDeadLetter)).Methods("GET")
+	router.HandleFunc("/pusher/deadletters/{id}/", s.scope(ScopeCancel, s.handlePurgeDeadLetter)).Methods("DELETE")
+	router.HandleFunc("/pusher/deadletters/{id}/replay", s.scope(ScopePush, s.handleReplayDeadLetter)).Methods("POST")
 
-	router.HandleFunc("/pusher/{sender}/push", wapperSenderHandle(s.handlePush)).Methods("POST")
-	router.HandleFunc("/pusher/{sender}/cancelpush", wapperSenderHandle(s.handleCancelPush)).Methods("POST")
-	router.HandleFunc("/pusher/{sender}/pushall", wapperSenderHandle(s.handlePushAll)).Methods("POST")
+	router.HandleFunc("/pusher/quotas/", s.scope(ScopeReadPushers, s.handleGetQuotas)).Methods("GET")
+	router.HandleFunc("/pusher/quotas/{sender}/", s.scope(ScopeAdmin, wapperSenderHandle(s.handleSetQuota))).Methods("POST")
+	router.HandleFunc("/pusher/quotas/{sender}/", s.scope(ScopeAdmin, wapperSenderHandle(s.handleRemoveQuota))).Methods("DELETE")
 	return router
 }
@@ -0,0 +1,39 @@
+package pusher
+
+import (
+	"encoding/json"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// DataError a field level error of the push data
+type DataError struct {
+	Field       string `json:"field"`
+	Description string `json:"description"`
+}
+
+func compileSchema(schema json.RawMessage) (*gojsonschema.Schema, error) {
+	if len(schema) == 0 {
+		return nil, nil
+	}
+	return gojsonschema.NewSchema(gojsonschema.NewBytesLoader(schema))
+}
+
+// validateData validate the push data with the sender schema,
+// return the field errors or err if the data is not a valid json
+func validateData(schema *gojsonschema.Schema, data string) ([]DataError, error) {
+	if schema == nil {
+		return nil, nil
+	}
+	result, err := schema.Validate(gojsonschema.NewStringLoader(data))
+	if err != nil {
+		return nil, err
+	}
+	if result.Valid() {
+		return nil, nil
+	}
+	var errs []DataError
+	for _, e := range result.Errors() {
+		errs = append(errs, DataError{Field: e.Field(), Description: e.Description()})
+	}
+	return errs, nil
+}
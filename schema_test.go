@@ -0,0 +1,99 @@
+package pusher
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+const mailSchema = `{
+	"type": "object",
+	"required": ["subject", "text"],
+	"properties": {"subject": {"type": "string"}, "text": {"type": "string"}}
+}`
+
+func TestCompileSchema(t *testing.T) {
+	var tests = []struct {
+		schema string
+		ok     bool
+	}{
+		{"", true},
+		{mailSchema, true},
+		{`{"type": "object"`, false},
+		{`{"type": 1}`, false},
+	}
+	for _, test := range tests {
+		if _, err := compileSchema(json.RawMessage(test.schema)); (err == nil) != test.ok {
+			t.Errorf("compileSchema(%s) err %v, want ok %v", test.schema, err, test.ok)
+		}
+	}
+}
+
+func TestValidateData(t *testing.T) {
+	schema, err := compileSchema(json.RawMessage(mailSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tests = []struct {
+		name    string
+		data    string
+		invalid bool
+		errs    []string
+	}{
+		{"valid", `{"subject": "hi", "text": "hello"}`, false, nil},
+		{"missing", `{"subject": "hi"}`, false, []string{"text is required"}},
+		{"type", `{"subject": 1, "text": "hello"}`, false, []string{"subject"}},
+		{"not object", `"hello"`, false, []string{"(root)"}},
+		{"not json", `{"subject": `, true, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errs, err := validateData(schema, test.data)
+			if (err != nil) != test.invalid {
+				t.Fatalf("validateData err %v, want invalid %v", err, test.invalid)
+			}
+			if len(errs) != len(test.errs) {
+				t.Fatalf("validateData errors %+v, want %v", errs, test.errs)
+			}
+			for i, want := range test.errs {
+				if errs[i].Field != want && errs[i].Description != want {
+					t.Errorf("the error %+v should be about %s", errs[i], want)
+				}
+			}
+		})
+	}
+	// the sender without schema accept any data
+	if errs, err := validateData(nil, "hello"); err != nil || len(errs) != 0 {
+		t.Fatalf("the data without schema should be valid, got %v %v", errs, err)
+	}
+}
+
+func TestPushInvalidData(t *testing.T) {
+	sp, p := newTestSPusher(t)
+	sp.senders.announce(SenderInfo{Name: "sendmail", Schema: json.RawMessage(mailSchema)}, "worker")
+	sp.storer.Set(Pusher{ID: "4711", Senders: []string{"sendmail"}})
+
+	var tests = []struct {
+		data string
+		code int
+	}{
+		{`{"subject": "hi"}`, http.StatusUnprocessableEntity},
+		{`{"subject": `, http.StatusUnprocessableEntity},
+		{`{"subject": "hi", "text": "hello"}`, http.StatusOK},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		sp.handlePush(rec, postForm("/pusher/sendmail/push", url.Values{
+			"pusher": {"4711"},
+			"data":   {test.data},
+		}, nil), "sendmail")
+		if rec.Code != test.code {
+			t.Errorf("push %s status %d, want %d", test.data, rec.Code, test.code)
+		}
+	}
+	if jobs := p.submitted(); len(jobs) != 1 {
+		t.Fatalf("submitted %d jobs, want only the valid one", len(jobs))
+	}
+}
@@ -0,0 +1,162 @@
+package pusher
+
+import (
+	"encoding/json"
+	"github.com/xeipuuv/gojsonschema"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SenderHeartbeat how often the worker announce the senders
+const SenderHeartbeat = 30 * time.Second
+
+// a worker is alive if it announced in the last three heartbeats
+const senderAlive = 3 * SenderHeartbeat
+
+// SenderInfo the capability metadata of a sender announced by the workers
+type SenderInfo struct {
+	Name string `json:"name"`
+	// Fields the pusher fields required by the sender, eg: email
+	Fields []string `json:"fields,omitempty"`
+	// Schema the json schema of the push data
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Workers the count of alive workers which consume the sender
+	Workers int `json:"workers"`
+	// Heartbeat the last time a worker announced the sender
+	Heartbeat int64 `json:"heartbeat"`
+	// Instances the worker instance with its last heartbeat
+	Instances map[string]int64 `json:"instances,omitempty"`
+}
+
+func (info *SenderInfo) countWorkers(now int64) {
+	info.Workers = 0
+	info.Heartbeat = 0
+	for _, heartbeat := range info.Instances {
+		if now-heartbeat <= int64(senderAlive/time.Second) {
+			info.Workers++
+		}
+		if heartbeat > info.Heartbeat {
+			info.Heartbeat = heartbeat
+		}
+	}
+}
+
+type senderRegistry struct {
+	locker  sync.RWMutex
+	senders map[string]SenderInfo
+	schemas map[string]*gojsonschema.Schema
+	bucket  Bucket
+}
+
+func newSenderRegistry(bucket Bucket) (*senderRegistry, error) {
+	var r = &senderRegistry{
+		senders: make(map[string]SenderInfo),
+		schemas: make(map[string]*gojsonschema.Schema),
+		bucket:  bucket,
+	}
+	err := bucket.ForEach(func(key string, value []byte) error {
+		var info SenderInfo
+		if err := json.Unmarshal(value, &info); err != nil {
+			return err
+		}
+		schema, err := compileSchema(info.Schema)
+		if err != nil {
+			return err
+		}
+		r.senders[key] = info
+		r.schemas[key] = schema
+		return nil
+	})
+	return r, err
+}
+
+// announce a sender from a worker instance
+func (r *senderRegistry) announce(info SenderInfo, worker string) error {
+	schema, err := compileSchema(info.Schema)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	var now = time.Now().Unix()
+	// copy on write, the old map may be in use by readers
+	var instances = make(map[string]int64)
+	for instance, heartbeat := range r.senders[info.Name].Instances {
+		// forget the long dead workers
+		if now-heartbeat <= int64(24*time.Hour/time.Second) {
+			instances[instance] = heartbeat
+		}
+	}
+	instances[worker] = now
+	info.Instances = instances
+	info.countWorkers(now)
+	data, _ := json.Marshal(info)
+	if err = r.bucket.Put(info.Name, data); err != nil {
+		return err
+	}
+	r.senders[info.Name] = info
+	r.schemas[info.Name] = schema
+	return nil
+}
+
+func (r *senderRegistry) remove(name string) error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	if err := r.bucket.Delete(name); err != nil {
+		return err
+	}
+	delete(r.senders, name)
+	delete(r.schemas, name)
+	return nil
+}
+
+// validate the push data with the sender schema
+func (r *senderRegistry) validate(name, data string) ([]DataError, error) {
+	r.locker.RLock()
+	schema := r.schemas[name]
+	r.locker.RUnlock()
+	return validateData(schema, data)
+}
+
+// missing the fields required by the sender which the pusher does not have
+func (r *senderRegistry) missing(name string, p Pusher) []string {
+	r.locker.RLock()
+	defer r.locker.RUnlock()
+	var fields []string
+	for _, field := range r.senders[name].Fields {
+		if p.Field(field) == "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func (r *senderRegistry) get(name string) (info SenderInfo, ok bool) {
+	r.locker.RLock()
+	defer r.locker.RUnlock()
+	if info, ok = r.senders[name]; ok {
+		info.countWorkers(time.Now().Unix())
+	}
+	return
+}
+
+func (r *senderRegistry) has(name string) bool {
+	_, ok := r.get(name)
+	return ok
+}
+
+func (r *senderRegistry) all() []SenderInfo {
+	r.locker.RLock()
+	defer r.locker.RUnlock()
+	var now = time.Now().Unix()
+	var senders = make([]SenderInfo, 0, len(r.senders))
+	for _, info := range r.senders {
+		info.countWorkers(now)
+		senders = append(senders, info)
+	}
+	sort.Slice(senders, func(i, j int) bool {
+		return senders[i].Name < senders[j].Name
+	})
+	return senders
+}
@@ -0,0 +1,52 @@
+package pusher
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestPushRequiredFields(t *testing.T) {
+	sp, p := newTestSPusher(t)
+	sp.senders.announce(SenderInfo{Name: "sendmail", Fields: []string{"email"}}, "worker")
+	sp.senders.announce(SenderInfo{Name: "sendsms", Fields: []string{"phoneNumber", "nickname"}}, "worker")
+	sp.storer.Set(Pusher{ID: "4711", Email: "lupino@example.com", Senders: []string{"sendmail", "sendsms"}})
+
+	var tests = []struct {
+		sender string
+		code   int
+	}{
+		{"sendmail", http.StatusOK},
+		{"sendsms", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		sp.handlePush(rec, postForm("/pusher/"+test.sender+"/push", url.Values{
+			"pusher": {"4711"},
+			"data":   {"hello"},
+		}, nil), test.sender)
+		if rec.Code != test.code {
+			t.Errorf("push %s status %d, want %d: %s", test.sender, rec.Code, test.code, rec.Body)
+		}
+	}
+	if jobs := p.submitted(); len(jobs) != 1 {
+		t.Fatalf("submitted %d jobs, want 1", len(jobs))
+	}
+}
+
+func TestAnnounceUnknownField(t *testing.T) {
+	sp, _ := newTestSPusher(t)
+	rec := httptest.NewRecorder()
+	sp.handleAnnounceSender(rec, postForm("/pusher/senders/", url.Values{
+		"sender": {"sendmail"},
+		"worker": {"worker"},
+		"field":  {"emial"},
+	}, nil))
+	if rec.Code != http.StatusNotAcceptable {
+		t.Fatalf("announce status %d, want %d", rec.Code, http.StatusNotAcceptable)
+	}
+	if sp.senders.has("sendmail") {
+		t.Fatal("the sender with an unknown field should not be announced")
+	}
+}
@@ -0,0 +1,48 @@
+package boltdb
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// Bucket defined a bolt Bucket interface
+type Bucket struct {
+	db     *bolt.DB
+	bucket string
+}
+
+// Put value into bucket
+func (b Bucket) Put(key string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(b.bucket)).Put([]byte(key), value)
+	})
+}
+
+// Get value from bucket
+func (b Bucket) Get(key string) ([]byte, error) {
+	var data []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket([]byte(b.bucket)).Get([]byte(key))
+		if v != nil {
+			data = make([]byte, len(v))
+			copy(data, v)
+		}
+		return nil
+	})
+	return data, err
+}
+
+// Delete value from bucket
+func (b Bucket) Delete(key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(b.bucket)).Delete([]byte(key))
+	})
+}
+
+// ForEach key value in bucket order by key
+func (b Bucket) ForEach(fn func(key string, value []byte) error) error {
+	return b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(b.bucket)).ForEach(func(k, v []byte) error {
+			return fn(string(k), v)
+		})
+	})
+}
@@ -127,3 +127,67 @@ func (s Store) GetAll(from, size int) (uint64, []pusher.Pusher, error) {
 	}
 	return total, pushers, nil
 }
+
+// Count the pushers by the bucket stats
+func (s Store) Count() (uint64, error) {
+	var total uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		total = uint64(tx.Bucket([]byte(s.bucket)).Stats().KeyN)
+		return nil
+	})
+	return total, err
+}
+
+// SetBatch save many pushers into store in one transaction
+func (s Store) SetBatch(ps []pusher.Pusher) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.bucket))
+		for _, p := range ps {
+			if err := b.Put([]byte(p.ID), p.Bytes()); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Ping check the bolt db is readable and the pushers bucket exists
+func (s Store) Ping() error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(s.bucket)) == nil {
+			return fmt.Errorf("bucket %s not exists", s.bucket)
+		}
+		return nil
+	})
+}
+
+// Bucket open a named bucket to store the other server data
+func (s Store) Bucket(name string) (pusher.Bucket, error) {
+	var bucket = s.bucket + ":" + name
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return Bucket{db: s.db, bucket: bucket}, nil
+}
+
+// Tenant open the store of a tenant, the pushers is in a bucket of the tenant
+func (s Store) Tenant(name string) (pusher.Storer, error) {
+	var bucket = s.bucket + "@" + name
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.bucket = bucket
+	return &s, nil
+}
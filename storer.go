@@ -7,3 +7,36 @@ type Storer interface {
 	Del(string) error
 	GetAll(from, size int) (uint64, []Pusher, error)
 }
+
+// BatchStorer is an optional interface for Storer to save many pushers in one transaction
+type BatchStorer interface {
+	SetBatch([]Pusher) error
+}
+
+// Bucket a simple key value store for the server data other than pushers
+type Bucket interface {
+	Put(key string, value []byte) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	ForEach(fn func(key string, value []byte) error) error
+}
+
+// BucketStorer is an optional interface for Storer to persist the other server data in named buckets
+type BucketStorer interface {
+	Bucket(name string) (Bucket, error)
+}
+
+// Counter is an optional interface for Storer to count the pushers without walk them
+type Counter interface {
+	Count() (uint64, error)
+}
+
+// Pinger is an optional interface for Storer to check the storage is available
+type Pinger interface {
+	Ping() error
+}
+
+// TenantStorer is an optional interface for Storer to store the pushers of a tenant apart
+type TenantStorer interface {
+	Tenant(name string) (Storer, error)
+}
@@ -0,0 +1,132 @@
+package pusher
+
+import (
+	"errors"
+	"github.com/blevesearch/bleve"
+	"github.com/gorilla/mux"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+// ErrTenantNotSupported the storer is not a TenantStorer
+var ErrTenantNotSupported = errors.New("storer not support tenant")
+
+var tenantRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// validTenant check the tenant name, the empty name is the default tenant
+func validTenant(tenant string) bool {
+	return tenant == "" || tenantRegexp.MatchString(tenant)
+}
+
+// tenantSet cache the router and the index of every tenant
+type tenantSet struct {
+	locker  sync.Mutex
+	routers map[string]*mux.Router
+	indexes map[string]bleve.Index
+}
+
+func newTenantSet() *tenantSet {
+	return &tenantSet{routers: make(map[string]*mux.Router), indexes: make(map[string]bleve.Index)}
+}
+
+// router get the tenant router, open the tenant on the first request
+func (ts *tenantSet) router(s SPusher, tenant string) (*mux.Router, error) {
+	ts.locker.Lock()
+	defer ts.locker.Unlock()
+	if router, ok := ts.routers[tenant]; ok {
+		return router, nil
+	}
+	sp, err := s.openTenant(tenant)
+	if err != nil {
+		return nil, err
+	}
+	router := sp.newRouter()
+	ts.routers[tenant] = router
+	if tenant != "" {
+		ts.indexes[tenant] = sp.index
+	}
+	return router, nil
+}
+
+// close the indexes of the opened tenants, the tenants are opened again on the next request
+func (ts *tenantSet) close() {
+	ts.locker.Lock()
+	defer ts.locker.Unlock()
+	for tenant, index := range ts.indexes {
+		if err := index.Close(); err != nil {
+			slog.Error("bleve.Index.Close() failed", "tenant", tenant, "err", err)
+		}
+	}
+	ts.routers = make(map[string]*mux.Router)
+	ts.indexes = make(map[string]bleve.Index)
+}
+
+// openTenant return a copy of the server pusher with the tenant storer, index and bulk jobs,
+// the sender registry and the api keys are shared by all the tenants
+func (s SPusher) openTenant(tenant string) (sp SPusher, err error) {
+	if tenant == "" {
+		return s, nil
+	}
+	ts, ok := s.storer.(TenantStorer)
+	if !ok {
+		err = ErrTenantNotSupported
+		return
+	}
+	var storer Storer
+	if storer, err = ts.Tenant(tenant); err != nil {
+		return
+	}
+	var path = filepath.Join(s.path, "tenants")
+	if err = os.MkdirAll(path, 0755); err != nil {
+		return
+	}
+	sp = s
+	sp.tenant = tenant
+	sp.storer = storer
+	sp.bulk = newBulkJobs()
+	if sp.index, err = openIndex(filepath.Join(path, tenant), storer); err != nil {
+		return
+	}
+	if s.hasMetrics() {
+		sp.index = metricIndex{bleveIndex: sp.index, metrics: s.metrics}
+	}
+	return
+}
+
+// requestTenant find the request tenant, the tenant of the api key,
+// or the X-Tenant header from an admin key
+func requestTenant(req *http.Request) (string, bool) {
+	var tenant = req.Header.Get("X-Tenant")
+	key, ok := requestKey(req)
+	if !ok {
+		return tenant, true
+	}
+	if key.Tenant != "" {
+		return key.Tenant, tenant == "" || tenant == key.Tenant
+	}
+	return tenant, tenant == "" || key.HasScope(ScopeAdmin)
+}
+
+// handleTenant dispatch the request to the tenant router
+func (s SPusher) handleTenant(w http.ResponseWriter, req *http.Request) {
+	tenant, ok := requestTenant(req)
+	if !ok {
+		sendJSONResponse(w, http.StatusForbidden, "err", "X-App-Key is not allowed to use the tenant "+tenant+".")
+		return
+	}
+	if !validTenant(tenant) {
+		sendJSONResponse(w, http.StatusBadRequest, "err", "Invalid X-Tenant")
+		return
+	}
+	router, err := s.tenants.router(s, tenant)
+	if err != nil {
+		s.reqLogger(req).Error("tenantSet.router() failed", "tenant", tenant, "err", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	router.ServeHTTP(w, req)
+}
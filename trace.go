@@ -0,0 +1,32 @@
+package pusher
+
+import (
+	"github.com/Lupino/pusher/tracing"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// trace continue the trace context of the request header with a server span,
+// the push handlers propagate it into the periodic job
+func (s SPusher) trace(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var route = req.URL.Path
+		if r := mux.CurrentRoute(req); r != nil {
+			if tpl, err := r.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		ctx := tracing.ExtractHeader(req.Context(), req.Header)
+		ctx, span := tracing.Start(ctx, req.Method+" "+route, trace.SpanKindServer,
+			attribute.String("http.method", req.Method),
+			attribute.String("http.route", route),
+			attribute.String("pusher.tenant", s.tenant),
+		)
+		defer span.End()
+		var sw = &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, req.WithContext(ctx))
+		span.SetAttributes(attribute.Int("http.status_code", sw.status))
+	})
+}
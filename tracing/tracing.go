@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+// Name the instrumentation name of the pusher tracer
+const Name = "github.com/Lupino/pusher"
+
+// Options the exporters of the tracing, the tracing is disabled without exporter
+type Options struct {
+	// Service the service name of the spans, eg: pusher, pusher_worker
+	Service string
+	// Endpoint the otlp http collector endpoint, eg: localhost:4318
+	Endpoint string
+	// Insecure connect the otlp collector without tls
+	Insecure bool
+	// File export the spans to the file as json, eg: for tests
+	File string
+}
+
+// Setup install the global tracer provider and the w3c trace context propagator,
+// return the shutdown to flush the spans
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	var providerOpts = []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", opts.Service))),
+	}
+	var file *os.File
+	if len(opts.Endpoint) > 0 {
+		var httpOpts = []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+		if opts.Insecure {
+			httpOpts = append(httpOpts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, httpOpts...)
+		if err != nil {
+			return nil, err
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+	if len(opts.File) > 0 {
+		if file, err = os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+			return nil, err
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		providerOpts = append(providerOpts, sdktrace.WithSyncer(exporter))
+	}
+	if len(providerOpts) == 1 {
+		return func(context.Context) error { return nil }, nil
+	}
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(provider)
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			file.Close()
+		}
+		return err
+	}, nil
+}
+
+// Start a span of the pusher tracer
+func Start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(Name).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// End the span, record the error if not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Inject the trace context of the ctx into the meta, return a new meta
+func Inject(ctx context.Context, meta map[string]string) map[string]string {
+	var carrier = make(propagation.MapCarrier)
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return meta
+	}
+	for k, v := range meta {
+		if _, ok := carrier[k]; !ok {
+			carrier[k] = v
+		}
+	}
+	return carrier
+}
+
+// Extract the trace context from the meta into the ctx
+func Extract(ctx context.Context, meta map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(meta))
+}
+
+// InjectHeader inject the trace context of the ctx into the http header
+func InjectHeader(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// ExtractHeader extract the trace context from the http header into the ctx
+func ExtractHeader(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
@@ -3,7 +3,11 @@ package utils
 import (
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"net/url"
 	"sort"
 	"strings"
 )
@@ -32,6 +36,21 @@ func VerifyData(expect, pusher, data string) bool {
 	return expect == got
 }
 
+// GeneratePayloadName for periodic job name base pusher and the payload,
+// the trace context and the pusher snapshot are not part of the name,
+// the same push is deduplicated by periodic.
+func GeneratePayloadName(pusher string, p Payload) string {
+	p.Trace = nil
+	p.Pusher = nil
+	return GenerateName(pusher, EncodePayload(p))
+}
+
+// VerifyPayload where the job args is the same with except name,
+// the name generated from the whole args is accepted too.
+func VerifyPayload(expect, pusher, args string) bool {
+	return VerifyData(expect, pusher, args) || expect == GeneratePayloadName(pusher, DecodePayload(args))
+}
+
 // HmacMD5 sign pusher request
 func HmacMD5(slot string, params map[string]string) string {
 	mac := hmac.New(md5.New, []byte(slot))
@@ -48,3 +67,114 @@ func HmacMD5(slot string, params map[string]string) string {
 
 	return strings.ToUpper(hex.EncodeToString(sum))
 }
+
+// SignVersion the signature version header value of HmacSHA256 signed request
+const SignVersion = "2"
+
+// SHA256 hex digest of data
+func SHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// CanonicalQuery encode the query sort by key then value
+func CanonicalQuery(query url.Values) string {
+	var keys []string
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, url.QueryEscape(key)+"="+url.QueryEscape(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// HmacSHA256 sign pusher request, the sign data is joined by new line:
+// method, path, canonical query, body sha256 digest, timestamp and nonce
+func HmacSHA256(secret, method, path string, query url.Values, body []byte, timestamp, nonce string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{
+		strings.ToUpper(method),
+		path,
+		CanonicalQuery(query),
+		SHA256(body),
+		timestamp,
+		nonce,
+	}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Nonce generate a random nonce for request
+func Nonce() string {
+	var buf = make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// JoinTenant qualify the pusher with the tenant, eg: tenant/pusher,
+// the pusher of the default tenant is not qualified.
+func JoinTenant(tenant, pusher string) string {
+	if tenant == "" {
+		return pusher
+	}
+	return tenant + "/" + pusher
+}
+
+// SplitTenant split the tenant from a qualified pusher.
+func SplitTenant(qualified string) (tenant, pusher string) {
+	idx := strings.Index(qualified, "/")
+	if idx == -1 {
+		return "", qualified
+	}
+	return qualified[:idx], qualified[idx+1:]
+}
+
+// payloadPrefix the prefix of the job args with the push options
+const payloadPrefix = "pusher:payload:"
+
+// Payload the push data with the push options, travel with the job as the args
+type Payload struct {
+	Data string `json:"data"`
+	// ExpiresAt the unix time the push is useless, 0 is never expires
+	ExpiresAt int64 `json:"expiresAt,omitempty"`
+	// Meta the metadata of the push
+	Meta map[string]string `json:"meta,omitempty"`
+	// Trace the trace context of the push, see the tracing package
+	Trace map[string]string `json:"trace,omitempty"`
+	// Pusher the pusher snapshot at submit time, the sender can skip the lookup
+	Pusher json.RawMessage `json:"pusher,omitempty"`
+}
+
+// Expired payload at the unix time now
+func (p Payload) Expired(now int64) bool {
+	return p.ExpiresAt > 0 && p.ExpiresAt <= now
+}
+
+// EncodePayload encode the payload to the job args,
+// the payload without options is the data as it is
+func EncodePayload(p Payload) string {
+	if p.ExpiresAt == 0 && len(p.Meta) == 0 && len(p.Trace) == 0 && len(p.Pusher) == 0 {
+		return p.Data
+	}
+	data, _ := json.Marshal(p)
+	return payloadPrefix + string(data)
+}
+
+// DecodePayload decode the job args, the args without the payload prefix is the data
+func DecodePayload(args string) Payload {
+	var p Payload
+	if !strings.HasPrefix(args, payloadPrefix) {
+		p.Data = args
+		return p
+	}
+	if err := json.Unmarshal([]byte(args[len(payloadPrefix):]), &p); err != nil {
+		p.Data = args
+	}
+	return p
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestGeneratePayloadName(t *testing.T) {
+	var p = Payload{Data: "hello", Meta: map[string]string{"id": "1"}}
+	var name = GeneratePayloadName("lupino", p)
+
+	var traced = p
+	traced.Trace = map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}
+	traced.Pusher = []byte(`{"id":"lupino"}`)
+	if got := GeneratePayloadName("lupino", traced); got != name {
+		t.Fatalf("the trace context changed the job name, got %s, want %s", got, name)
+	}
+	if !VerifyPayload(name, "lupino", EncodePayload(traced)) {
+		t.Fatal("VerifyPayload() rejected the traced args")
+	}
+
+	if got := GeneratePayloadName("lupino", Payload{Data: "hello"}); got != GenerateName("lupino", "hello") {
+		t.Fatalf("the payload without options changed the job name, got %s", got)
+	}
+	if VerifyPayload(name, "lupino", EncodePayload(Payload{Data: "hello"})) {
+		t.Fatal("VerifyPayload() accepted the args without the meta")
+	}
+}
+
+func TestCanonicalQuery(t *testing.T) {
+	var tests = []struct {
+		query url.Values
+		want  string
+	}{
+		{url.Values{}, ""},
+		{url.Values{"size": {"10"}, "from": {"0"}}, "from=0&size=10"},
+		{url.Values{"tag": {"b", "a"}}, "tag=a&tag=b"},
+		{url.Values{"q": {"tags:vip senders:sendmail"}}, "q=tags%3Avip+senders%3Asendmail"},
+	}
+	for _, test := range tests {
+		if got := CanonicalQuery(test.query); got != test.want {
+			t.Errorf("CanonicalQuery(%v) = %s, want %s", test.query, got, test.want)
+		}
+	}
+}
+
+func TestHmacSHA256(t *testing.T) {
+	var (
+		query = url.Values{"from": {"0"}}
+		body  = []byte(`{"pusher": "4711"}`)
+		sign  = HmacSHA256("secret", "post", "/pusher/pushers/", query, body, "1456403493", "nonce")
+	)
+	if got := HmacSHA256("secret", "POST", "/pusher/pushers/", url.Values{"from": {"0"}}, body, "1456403493", "nonce"); got != sign {
+		t.Fatal("the method should be signed in upper case")
+	}
+	var tests = []struct {
+		name string
+		sign string
+	}{
+		{"secret", HmacSHA256("other", "POST", "/pusher/pushers/", query, body, "1456403493", "nonce")},
+		{"method", HmacSHA256("secret", "GET", "/pusher/pushers/", query, body, "1456403493", "nonce")},
+		{"path", HmacSHA256("secret", "POST", "/pusher/search/", query, body, "1456403493", "nonce")},
+		{"query", HmacSHA256("secret", "POST", "/pusher/pushers/", url.Values{"from": {"10"}}, body, "1456403493", "nonce")},
+		{"body", HmacSHA256("secret", "POST", "/pusher/pushers/", query, []byte(`{"pusher": "4712"}`), "1456403493", "nonce")},
+		{"timestamp", HmacSHA256("secret", "POST", "/pusher/pushers/", query, body, "1456403494", "nonce")},
+		{"nonce", HmacSHA256("secret", "POST", "/pusher/pushers/", query, body, "1456403493", "other")},
+	}
+	for _, test := range tests {
+		if test.sign == sign {
+			t.Errorf("the %s should be signed", test.name)
+		}
+	}
+}
+
+func TestPayloadExpired(t *testing.T) {
+	var tests = []struct {
+		expiresAt int64
+		now       int64
+		expired   bool
+	}{
+		{0, 1456403493, false},
+		{1456403494, 1456403493, false},
+		{1456403493, 1456403493, true},
+		{1456403492, 1456403493, true},
+	}
+	for _, test := range tests {
+		if got := (Payload{Data: "hello", ExpiresAt: test.expiresAt}).Expired(test.now); got != test.expired {
+			t.Errorf("Payload{ExpiresAt: %d}.Expired(%d) = %v, want %v", test.expiresAt, test.now, got, test.expired)
+		}
+	}
+}
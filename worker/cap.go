@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	pusherLib "github.com/Lupino/pusher"
+	"time"
+)
+
+// CapAction what to do with the job to a pusher over the frequency caps
+type CapAction int
+
+const (
+	// CapDrop drop the job
+	CapDrop CapAction = iota
+	// CapDefer send the job later when the exceeded cap window end
+	CapDefer
+)
+
+type senderCaps struct {
+	caps   []pusherLib.Cap
+	action CapAction
+}
+
+// SetCaps set the frequency caps of a sender, eg: at most 3 sms per pusher an hour,
+// the caps are counted by the pusher server when the worker is about to send,
+// and refunded when the push is not delivered, eg: retry later.
+func (w *Worker) SetCaps(sender string, action CapAction, caps ...pusherLib.Cap) {
+	if len(caps) == 0 {
+		delete(w.caps, sender)
+		return
+	}
+	w.caps[sender] = senderCaps{caps: caps, action: action}
+}
+
+// takeCap take the sender caps of the pusher, allow the job if the pusher server is unavailable,
+// taken is true when the allowed push is counted
+func (w Worker) takeCap(tenant, sender, pusher string) (ret pusherLib.CapResult, action CapAction, taken bool) {
+	sc, ok := w.caps[sender]
+	if !ok {
+		return pusherLib.CapResult{Allowed: true}, CapDrop, false
+	}
+	ret, err := w.GetTenantAPI(tenant).TakeCap(sender, pusher, sc.caps)
+	if err != nil {
+		w.logger.Error("client.PusherClient.TakeCap() failed", "sender", sender, "pusher", pusher, "err", err)
+		return pusherLib.CapResult{Allowed: true}, sc.action, false
+	}
+	return ret, sc.action, ret.Allowed
+}
+
+const (
+	// refundTries the attempts to refund the caps of a push
+	refundTries = 3
+	// refundBackoff the delay before the next refund attempt, multiplied by the attempt
+	refundBackoff = 100 * time.Millisecond
+)
+
+// refundCap refund the sender caps of the pusher taken by takeCap by the report queue,
+// retry the failed refund, or the pusher is capped for a push it never got
+func (w Worker) refundCap(tenant, sender, pusher string) {
+	sc, ok := w.caps[sender]
+	if !ok {
+		return
+	}
+	w.reports.enqueue(func(ctx context.Context) {
+		api := w.GetTenantAPI(tenant).WithContext(ctx)
+		for i := 1; ; i++ {
+			err := api.RefundCap(sender, pusher, sc.caps)
+			if err == nil {
+				return
+			}
+			if i >= refundTries || ctx.Err() != nil {
+				w.logger.Error("client.PusherClient.RefundCap() failed", "sender", sender, "pusher", pusher, "err", err)
+				return
+			}
+			time.Sleep(time.Duration(i) * refundBackoff)
+		}
+	})
+}
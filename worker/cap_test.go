@@ -0,0 +1,95 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"github.com/Lupino/go-periodic"
+	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/utils"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testAcker record the ack of a periodic job
+type testAcker struct {
+	done  bool
+	later int
+}
+
+func (a *testAcker) Done() error {
+	a.done = true
+	return nil
+}
+
+func (a *testAcker) SchedLater(delay int, step int) error {
+	a.later = delay
+	return nil
+}
+
+// capServer a pusher server allow every cap, fail the first failRefunds refunds
+func capServer(t *testing.T, failRefunds int32) (*httptest.Server, *int32) {
+	var refunds int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/pusher/caps/sendmail/":
+			w.Write([]byte(`{"allowed": true}`))
+		case "/pusher/caps/sendmail/refund":
+			if atomic.AddInt32(&refunds, 1) <= failRefunds {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &refunds
+}
+
+func TestRefundCap(t *testing.T) {
+	var tests = []struct {
+		name        string
+		err         error
+		failRefunds int32
+		refunds     int32
+		done        bool
+	}{
+		{name: "sent", refunds: 0, done: true},
+		{name: "retry", err: errors.New("unavailable"), refunds: 1},
+		{name: "failed", err: Permanent(errors.New("invalid")), refunds: 1, done: true},
+		{name: "refund retried", err: errors.New("unavailable"), failRefunds: 2, refunds: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, refunds := capServer(t, test.failRefunds)
+			w := New(nil, srv.Listener.Addr().String(), "", "")
+			w.SetCaps("sendmail", CapDrop, pusherLib.Cap{Max: 3, Per: 3600})
+			sender := SenderFunc("sendmail", func(ctx context.Context, job Job) (int, error) {
+				return 0, test.err
+			})
+
+			var payload = utils.Payload{Data: "hello"}
+			var ack testAcker
+			jobHandler(w, sender, "", pusherLib.PriorityNormal)(periodic.Job{
+				Name: utils.GeneratePayloadName("4711", payload),
+				Args: utils.EncodePayload(payload),
+			}, &ack)
+			if ack.done != test.done {
+				t.Errorf("job done %v, want %v", ack.done, test.done)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := w.Shutdown(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if n := atomic.LoadInt32(refunds); n != test.refunds {
+				t.Errorf("refund %d times, want %d", n, test.refunds)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+package worker
+
+// SetConcurrency set the max concurrent sends of a sender, 0 is unlimited,
+// the concurrency is split to the priorities by the shares, every priority of the sender
+// run on its own periodic worker of its part, need SetPeriodicPort
+func (w *Worker) SetConcurrency(sender string, concurrency int) {
+	w.pools.locker.Lock()
+	defer w.pools.locker.Unlock()
+	if concurrency > 0 {
+		w.pools.limits[sender] = concurrency
+	} else {
+		delete(w.pools.limits, sender)
+	}
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// successTracker track the unix time of the last successful job per sender
+type successTracker struct {
+	locker sync.Mutex
+	last   map[string]int64
+}
+
+func newSuccessTracker() *successTracker {
+	return &successTracker{last: make(map[string]int64)}
+}
+
+func (st *successTracker) set(sender string, at int64) {
+	st.locker.Lock()
+	defer st.locker.Unlock()
+	st.last[sender] = at
+}
+
+// SenderHealth the health of a running sender
+type SenderHealth struct {
+	// LastSuccess the unix time of the last successful job, 0 if none since the worker start
+	LastSuccess int64 `json:"lastSuccess"`
+}
+
+// Health the health of the worker
+type Health struct {
+	// Periodic the periodic server is reachable
+	Periodic bool `json:"periodic"`
+	// Draining the worker is shutting down
+	Draining bool                    `json:"draining"`
+	Senders  map[string]SenderHealth `json:"senders"`
+}
+
+// Ready the worker is connected to the periodic server and not draining
+func (h Health) Ready() bool {
+	return h.Periodic && !h.Draining
+}
+
+// Health check the periodic connection, report the last successful job per sender
+func (w Worker) Health() Health {
+	w.life.locker.Lock()
+	var health = Health{
+		Draining: w.life.draining,
+		Senders:  make(map[string]SenderHealth, len(w.life.senders)),
+	}
+	senders := w.life.senders
+	w.life.locker.Unlock()
+
+	w.successes.locker.Lock()
+	for _, sender := range senders {
+		health.Senders[sender] = SenderHealth{LastSuccess: w.successes.last[sender]}
+	}
+	w.successes.locker.Unlock()
+
+	health.Periodic = true
+	for _, pw := range w.periodicWorkers() {
+		if !pw.Ping() {
+			health.Periodic = false
+		}
+	}
+	return health
+}
+
+// HandleHealthz reply the worker health, 503 if the periodic server is not reachable
+func (w Worker) HandleHealthz(rw http.ResponseWriter, req *http.Request) {
+	health := w.Health()
+	var status = http.StatusOK
+	if !health.Periodic {
+		status = http.StatusServiceUnavailable
+	}
+	sendHealth(rw, status, health)
+}
+
+// HandleReadyz reply the worker health, 503 if the worker is not ready to take jobs
+func (w Worker) HandleReadyz(rw http.ResponseWriter, req *http.Request) {
+	health := w.Health()
+	var status = http.StatusOK
+	if !health.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	sendHealth(rw, status, health)
+}
+
+func sendHealth(rw http.ResponseWriter, status int, health Health) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	json.NewEncoder(rw).Encode(health)
+}
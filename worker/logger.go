@@ -0,0 +1,37 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+)
+
+type loggerKey struct{}
+
+// SetLogger set the structured logger of the worker and its api client,
+// set it before create the senders, the default is slog.Default()
+func (w *Worker) SetLogger(logger *slog.Logger) {
+	w.logger = logger
+	w.api.SetLogger(logger)
+}
+
+// Logger return the structured logger of the worker
+func (w Worker) Logger() *slog.Logger {
+	return w.logger
+}
+
+// withJobLogger attach the job name, sender, pusher, tenant and attempt to the logger of the ctx
+func (w Worker) withJobLogger(ctx context.Context, job Job) context.Context {
+	logger := w.logger.With("job", job.Name, "sender", job.Sender, "pusher", job.Pusher, "attempt", job.Attempt)
+	if job.Tenant != "" {
+		logger = logger.With("tenant", job.Tenant)
+	}
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// JobLogger return the logger of the send ctx with the job attributes, or slog.Default()
+func JobLogger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"time"
+)
+
+// job results of the Metrics
+const (
+	// ResultInvalid the job failed the VerifyData and is ignored
+	ResultInvalid = "invalid"
+	// ResultDead the job is moved to the dead letters
+	ResultDead = "dead"
+)
+
+// Metrics collect the metrics of the worker, see the metrics package for prometheus
+type Metrics interface {
+	// IncJob count a job result of the sender, the result is the delivery status,
+	// eg: sent, retry, failed, expired, or ResultInvalid and ResultDead
+	IncJob(sender, result string)
+	// ObserveSend a send of the sender
+	ObserveSend(sender string, elapsed time.Duration, err error)
+	// AddInflight add the delta to the in-flight sends of the sender
+	AddInflight(sender string, delta int)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) IncJob(sender, result string)                                {}
+func (nopMetrics) ObserveSend(sender string, elapsed time.Duration, err error) {}
+func (nopMetrics) AddInflight(sender string, delta int)                        {}
+
+// SetMetrics collect the metrics of every sender
+func (w *Worker) SetMetrics(metrics Metrics) {
+	w.metrics = metrics
+}
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// Middleware wrap a sender with the cross-cutting behaviour, eg: logging, metrics
+type Middleware func(SenderV2) SenderV2
+
+// senderFunc a SenderV2 of a name and a send function
+type senderFunc struct {
+	name string
+	send func(ctx context.Context, job Job) (int, error)
+}
+
+// SenderFunc return a SenderV2 of the name and the send function, help to write the middleware
+func SenderFunc(name string, send func(ctx context.Context, job Job) (int, error)) SenderV2 {
+	return senderFunc{name: name, send: send}
+}
+
+func (s senderFunc) GetName() string {
+	return s.name
+}
+
+func (s senderFunc) SendJob(ctx context.Context, job Job) (int, error) {
+	return s.send(ctx, job)
+}
+
+// Use register the middlewares, Run wrap every sender with them in order,
+// the first middleware is the outermost
+func (w *Worker) Use(middlewares ...Middleware) {
+	w.middlewares = append(w.middlewares, middlewares...)
+}
+
+// wrap the sender with the middlewares
+func (w Worker) wrap(sender SenderV2) SenderV2 {
+	for i := len(w.middlewares) - 1; i >= 0; i-- {
+		sender = w.middlewares[i](sender)
+	}
+	return sender
+}
+
+// Recovery recover the panic of the sender, fail the job without retry,
+// the worker always recover the panic, use it to recover inside the other middlewares
+func Recovery() Middleware {
+	return func(next SenderV2) SenderV2 {
+		return SenderFunc(next.GetName(), func(ctx context.Context, job Job) (later int, err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					later, err = 0, recoverPanic(ctx, r)
+				}
+			}()
+			return next.SendJob(ctx, job)
+		})
+	}
+}
+
+// Logging log every send with the attempt, the elapsed time and the result
+func Logging() Middleware {
+	return func(next SenderV2) SenderV2 {
+		return SenderFunc(next.GetName(), func(ctx context.Context, job Job) (int, error) {
+			var start = time.Now()
+			later, err := next.SendJob(ctx, job)
+			if err != nil {
+				JobLogger(ctx).Warn("send failed", "elapsed", time.Since(start), "err", err)
+			} else {
+				JobLogger(ctx).Info("send", "elapsed", time.Since(start), "later", later)
+			}
+			return later, err
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// PanicError a panic recovered from the sender, the job fail without retry
+type PanicError struct {
+	Value interface{}
+	// Stack the goroutine stack of the panic
+	Stack string
+}
+
+func (e PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// recoverPanic log the recovered panic of the job, return a permanent PanicError
+func recoverPanic(ctx context.Context, r interface{}) error {
+	var stack = string(debug.Stack())
+	JobLogger(ctx).Error("sender panic", "panic", fmt.Sprint(r), "stack", stack)
+	return Permanent(PanicError{Value: r, Stack: stack})
+}
+
+// panicCounter count the recovered panics per sender
+type panicCounter struct {
+	locker sync.Mutex
+	counts map[string]int64
+}
+
+func newPanicCounter() *panicCounter {
+	return &panicCounter{counts: make(map[string]int64)}
+}
+
+func (pc *panicCounter) incr(sender string) {
+	pc.locker.Lock()
+	defer pc.locker.Unlock()
+	pc.counts[sender]++
+}
+
+// Panics return the count of the recovered panics per sender
+func (w Worker) Panics() map[string]int64 {
+	w.panics.locker.Lock()
+	defer w.panics.locker.Unlock()
+	var counts = make(map[string]int64, len(w.panics.counts))
+	for sender, count := range w.panics.counts {
+		counts[sender] = count
+	}
+	return counts
+}
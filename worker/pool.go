@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"github.com/Lupino/go-periodic"
+	pusherLib "github.com/Lupino/pusher"
+	"runtime"
+	"sync"
+)
+
+// pools the periodic workers of the priorities and the senders with the concurrency,
+// every pool fetch the jobs only when it has the free goroutines, so the jobs over
+// the pool size stay in the periodic queue in order
+type pools struct {
+	locker sync.Mutex
+	port   string
+	// size the goroutines size, split to the priorities by the shares
+	size    int
+	shares  map[string]int
+	limits  map[string]int
+	workers map[string]*periodic.Worker
+}
+
+func newPools() *pools {
+	return &pools{
+		size: runtime.NumCPU() * 2,
+		shares: map[string]int{
+			pusherLib.PriorityHigh:   100,
+			pusherLib.PriorityNormal: 80,
+			pusherLib.PriorityLow:    50,
+		},
+		limits:  make(map[string]int),
+		workers: make(map[string]*periodic.Worker),
+	}
+}
+
+// splitShares split the goroutines size to the priorities by the shares, every priority has one goroutine at least,
+// return false if the size is less than the priorities
+func splitShares(size int, shares map[string]int) (map[string]int, bool) {
+	if size < len(pusherLib.Priorities) {
+		return nil, false
+	}
+	var total int
+	for _, priority := range pusherLib.Priorities {
+		if shares[priority] > 0 {
+			total += shares[priority]
+		}
+	}
+	var (
+		sizes  = make(map[string]int, len(pusherLib.Priorities))
+		remain = size - len(pusherLib.Priorities)
+		left   = remain
+	)
+	for _, priority := range pusherLib.Priorities {
+		sizes[priority] = 1
+		if total > 0 && shares[priority] > 0 {
+			n := remain * shares[priority] / total
+			sizes[priority] += n
+			left -= n
+		}
+	}
+	// the rounding left goes to the higher priorities
+	for i := 0; left > 0; i = (i + 1) % len(pusherLib.Priorities) {
+		sizes[pusherLib.Priorities[i]]++
+		left--
+	}
+	return sizes, true
+}
+
+// SetPeriodicPort set the periodic server port to connect the periodic workers of the priorities
+// and the senders with the concurrency, without it all the funcs run on the periodic worker of New,
+// the priority shares and the concurrency are not applied
+func (w *Worker) SetPeriodicPort(port string) {
+	w.pools.locker.Lock()
+	defer w.pools.locker.Unlock()
+	w.pools.port = port
+}
+
+// checkPools warn the priority shares and the concurrency which can not be applied
+func (w Worker) checkPools(senders []SenderV2) {
+	w.pools.locker.Lock()
+	defer w.pools.locker.Unlock()
+	if w.pools.port == "" {
+		w.logger.Warn("no periodic port, the priorities share the periodic worker, the priority shares are not applied")
+		for _, sender := range senders {
+			if _, ok := w.pools.limits[sender.GetName()]; ok {
+				w.logger.Warn("no periodic port, the sender concurrency is not applied", "sender", sender.GetName())
+			}
+		}
+		return
+	}
+	if _, ok := splitShares(w.pools.size, w.pools.shares); !ok {
+		w.logger.Warn("the size is less than the priorities, the priorities share the periodic worker", "size", w.pools.size)
+	}
+	for _, sender := range senders {
+		limit, ok := w.pools.limits[sender.GetName()]
+		if !ok {
+			continue
+		}
+		if _, ok := splitShares(limit, w.pools.shares); !ok {
+			w.logger.Warn("the sender concurrency is less than the priorities, the priorities share the sender periodic worker",
+				"sender", sender.GetName(), "concurrency", limit)
+		}
+	}
+}
+
+// periodicWorker return the periodic worker of the sender and the priority, connect it on the first use.
+// The goroutines size is split to the priorities by the shares,
+// the sender with the concurrency split the concurrency to the priorities the same way.
+func (w Worker) periodicWorker(sender, priority string) (*periodic.Worker, error) {
+	w.pools.locker.Lock()
+	defer w.pools.locker.Unlock()
+	if w.pools.port == "" {
+		return w.w, nil
+	}
+	var name, size = "priority:", w.pools.size
+	if limit, ok := w.pools.limits[sender]; ok {
+		name, size = "sender:"+sender+":", limit
+	}
+	if sizes, ok := splitShares(size, w.pools.shares); ok {
+		name, size = name+priority, sizes[priority]
+	}
+	if pw, ok := w.pools.workers[name]; ok {
+		return pw, nil
+	}
+	pw := periodic.NewWorker(size)
+	if err := pw.Connect(w.pools.port); err != nil {
+		return nil, err
+	}
+	w.pools.workers[name] = pw
+	return pw, nil
+}
+
+// periodicWorkers return the periodic workers which have the funcs registered by Run,
+// the periodic worker of New before Run
+func (w Worker) periodicWorkers() []*periodic.Worker {
+	w.life.locker.Lock()
+	defer w.life.locker.Unlock()
+	var (
+		workers []*periodic.Worker
+		seen    = make(map[*periodic.Worker]bool)
+	)
+	for _, f := range w.life.funcs {
+		if !seen[f.pw] {
+			seen[f.pw] = true
+			workers = append(workers, f.pw)
+		}
+	}
+	if len(workers) == 0 {
+		workers = append(workers, w.w)
+	}
+	return workers
+}
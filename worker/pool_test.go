@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitShares(t *testing.T) {
+	var defaults = newPools().shares
+	var tests = []struct {
+		size   int
+		shares map[string]int
+		want   map[string]int
+	}{
+		{16, defaults, map[string]int{"high": 7, "normal": 6, "low": 3}},
+		{3, defaults, map[string]int{"high": 1, "normal": 1, "low": 1}},
+		{4, defaults, map[string]int{"high": 2, "normal": 1, "low": 1}},
+		{10, map[string]int{"high": 1, "normal": 1, "low": 1}, map[string]int{"high": 4, "normal": 3, "low": 3}},
+		{10, map[string]int{"high": 100}, map[string]int{"high": 8, "normal": 1, "low": 1}},
+		{5, map[string]int{}, map[string]int{"high": 2, "normal": 2, "low": 1}},
+		{2, defaults, nil},
+	}
+	for _, test := range tests {
+		got, ok := splitShares(test.size, test.shares)
+		if ok != (test.want != nil) || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitShares(%d, %v) = %v %v, want %v", test.size, test.shares, got, ok, test.want)
+		}
+		var total int
+		for _, n := range got {
+			total += n
+		}
+		if ok && total != test.size {
+			t.Errorf("splitShares(%d, %v) total %d", test.size, test.shares, total)
+		}
+	}
+}
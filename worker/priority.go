@@ -0,0 +1,17 @@
+package worker
+
+// SetSize set the size of the periodic worker goroutines split to the priorities, the default is runtime.NumCPU() * 2
+func (w *Worker) SetSize(size int) {
+	w.pools.locker.Lock()
+	defer w.pools.locker.Unlock()
+	w.pools.size = size
+}
+
+// SetPriorityShare set the share of the worker goroutines of a priority, the goroutines size
+// is split to the priorities by the shares, the default is high 100, normal 80 and low 50.
+// A priority run on its own periodic worker of its part, need SetPeriodicPort
+func (w *Worker) SetPriorityShare(priority string, percent int) {
+	w.pools.locker.Lock()
+	defer w.pools.locker.Unlock()
+	w.pools.shares[priority] = percent
+}
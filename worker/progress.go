@@ -0,0 +1,26 @@
+package worker
+
+import "context"
+
+// Progress the progress of a job push to many pushers, eg: pushall
+type Progress struct {
+	// Offset the pushers already handled
+	Offset int
+	// Failed the pushers failed to push
+	Failed int
+}
+
+type progressKey struct{}
+
+// WithProgress return a ctx the sender save the progress to, the worker install it for every send
+func WithProgress(ctx context.Context, progress *Progress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+// SetProgress save the progress of the job, the worker report it with the delivery status,
+// so the next attempt can resume from it
+func SetProgress(ctx context.Context, progress Progress) {
+	if p, ok := ctx.Value(progressKey{}).(*Progress); ok {
+		*p = progress
+	}
+}
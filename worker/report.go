@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"context"
+	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/client"
+	"sync"
+	"time"
+)
+
+const (
+	// reportQueueSize the reports queued to the pusher server, the jobs wait when it is full
+	reportQueueSize = 1024
+	// reportWorkers the goroutines send the queued reports
+	reportWorkers = 4
+	// reportTimeout the timeout of a report request
+	reportTimeout = 10 * time.Second
+)
+
+// reporter a bounded queue of the requests report to the pusher server, eg: the delivery status,
+// Shutdown drain it after the in-flight sends
+type reporter struct {
+	once    sync.Once
+	queue   chan func(ctx context.Context)
+	pending sync.WaitGroup
+}
+
+func newReporter() *reporter {
+	return &reporter{queue: make(chan func(ctx context.Context), reportQueueSize)}
+}
+
+// enqueue the report, run it in place without the queue, eg: a zero Worker
+func (r *reporter) enqueue(fn func(ctx context.Context)) {
+	if r == nil {
+		runReport(fn)
+		return
+	}
+	r.once.Do(func() {
+		for i := 0; i < reportWorkers; i++ {
+			go func() {
+				for fn := range r.queue {
+					runReport(fn)
+					r.pending.Done()
+				}
+			}()
+		}
+	})
+	r.pending.Add(1)
+	r.queue <- fn
+}
+
+func runReport(fn func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(context.Background(), reportTimeout)
+	defer cancel()
+	fn(ctx)
+}
+
+// drain wait the queued reports until the ctx is done, return false if they are not finished
+func (r *reporter) drain(ctx context.Context) bool {
+	if r == nil {
+		return true
+	}
+	var done = make(chan struct{})
+	go func() {
+		r.pending.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// report the delivery status to the pusher server by the report queue
+func (w Worker) report(tenant string, status pusherLib.DeliveryStatus) {
+	w.metrics.IncJob(status.Sender, status.Status)
+	if status.Status == pusherLib.DeliverySent {
+		w.successes.set(status.Sender, time.Now().Unix())
+	}
+	w.reports.enqueue(func(ctx context.Context) {
+		if err := w.GetTenantAPI(tenant).WithContext(ctx).SetDeliveryStatus(status); err != nil {
+			w.logger.Error("client.PusherClient.SetDeliveryStatus() failed", "job", status.Name, "err", err)
+		}
+	})
+}
+
+// reportDead report the delivery status then move the job to the dead letters,
+// the dead letter copy the delivery history
+func (w Worker) reportDead(tenant string, status pusherLib.DeliveryStatus, letter client.DeadLetter) {
+	w.metrics.IncJob(status.Sender, status.Status)
+	w.metrics.IncJob(status.Sender, ResultDead)
+	w.reports.enqueue(func(ctx context.Context) {
+		api := w.GetTenantAPI(tenant).WithContext(ctx)
+		if err := api.SetDeliveryStatus(status); err != nil {
+			w.logger.Error("client.PusherClient.SetDeliveryStatus() failed", "job", status.Name, "err", err)
+		}
+		if err := api.AddDeadLetter(letter); err != nil {
+			w.logger.Error("client.PusherClient.AddDeadLetter() failed", "job", status.Name, "err", err)
+		}
+	})
+}
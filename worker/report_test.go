@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"context"
+	pusherLib "github.com/Lupino/pusher"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainReports(t *testing.T) {
+	var reported int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&reported, 1)
+	}))
+	defer srv.Close()
+
+	w := New(nil, srv.Listener.Addr().String(), "", "")
+	for i := 0; i < 10; i++ {
+		w.report("", pusherLib.DeliveryStatus{Name: "job", Sender: "sendmail", Status: pusherLib.DeliverySent})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&reported); n != 10 {
+		t.Fatalf("reported %d statuses before the shutdown return, want 10", n)
+	}
+}
+
+func TestShutdownReportsDeadline(t *testing.T) {
+	var release = make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	w := New(nil, srv.Listener.Addr().String(), "", "")
+	w.report("", pusherLib.DeliveryStatus{Name: "job", Sender: "sendmail", Status: pusherLib.DeliverySent})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("the shutdown should return the deadline with the report pending, got %v", err)
+	}
+}
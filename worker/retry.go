@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy how a sender retry the failed job
+type RetryPolicy struct {
+	// MaxAttempts the max times to send a job, include the first send
+	MaxAttempts int
+	// BaseDelay the delay before the first retry
+	BaseDelay time.Duration
+	// MaxDelay the max delay between two retries
+	MaxDelay time.Duration
+	// Multiplier the delay grow by every retry
+	Multiplier float64
+	// Jitter randomize the delay by the fraction, eg: 0.2 is ±20%
+	Jitter float64
+}
+
+// DefaultRetryPolicy the retry policy of the sender without policy
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   10 * time.Second,
+	MaxDelay:    time.Hour,
+	Multiplier:  2,
+	Jitter:      0.2,
+}
+
+// Delay the exponential backoff delay before the next retry,
+// the attempt is the times the job was sent, start from 1
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	var delay = float64(p.BaseDelay) * math.Pow(math.Max(p.Multiplier, 1), float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay = delay * (1 + p.Jitter*(2*rand.Float64()-1))
+	}
+	if delay < float64(time.Second) {
+		delay = float64(time.Second)
+	}
+	return time.Duration(delay)
+}
+
+// PermanentError a send error the retry never succeed, eg: an invalid phone number
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent mark the error as permanent, the job fail without retry
+func Permanent(err error) error {
+	return PermanentError{Err: err}
+}
+
+// IsPermanent check the error is a PermanentError
+func IsPermanent(err error) bool {
+	var pe PermanentError
+	return errors.As(err, &pe)
+}
+
+// Abandoned mark the error of a request cancelled by the ctx as permanent, the request may be
+// delivered before it is cancelled, so a retry may send it twice. The other errors return as it is.
+func Abandoned(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || IsPermanent(err) {
+		return err
+	}
+	return Permanent(fmt.Errorf("the request is abandoned, it may be delivered (%w)", err))
+}
+
+// SetRetryPolicy set the retry policy of a sender
+func (w *Worker) SetRetryPolicy(sender string, policy RetryPolicy) {
+	w.retry[sender] = policy
+}
+
+func (w Worker) retryPolicy(sender string) RetryPolicy {
+	if policy, ok := w.retry[sender]; ok {
+		return policy
+	}
+	var policy = DefaultRetryPolicy
+	policy.MaxAttempts = int(w.tryTimes)
+	return policy
+}
@@ -0,0 +1,71 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	var tests = []struct {
+		name    string
+		policy  RetryPolicy
+		attempt int
+		want    time.Duration
+	}{
+		{"first", RetryPolicy{BaseDelay: 10 * time.Second, Multiplier: 2}, 1, 10 * time.Second},
+		{"grow", RetryPolicy{BaseDelay: 10 * time.Second, Multiplier: 2}, 3, 40 * time.Second},
+		{"max delay", RetryPolicy{BaseDelay: 10 * time.Second, MaxDelay: 30 * time.Second, Multiplier: 2}, 5, 30 * time.Second},
+		{"no multiplier", RetryPolicy{BaseDelay: 10 * time.Second}, 4, 10 * time.Second},
+		{"shrink multiplier", RetryPolicy{BaseDelay: 10 * time.Second, Multiplier: 0.5}, 4, 10 * time.Second},
+		{"one second floor", RetryPolicy{BaseDelay: time.Millisecond, Multiplier: 2}, 2, time.Second},
+	}
+	for _, test := range tests {
+		if got := test.policy.Delay(test.attempt); got != test.want {
+			t.Errorf("%s: Delay(%d) = %s, want %s", test.name, test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestRetryDelayJitter(t *testing.T) {
+	var policy = RetryPolicy{BaseDelay: 10 * time.Second, MaxDelay: 20 * time.Second, Multiplier: 2, Jitter: 0.2}
+	for attempt := 1; attempt <= 3; attempt++ {
+		var base = policy.BaseDelay << (attempt - 1)
+		if base > policy.MaxDelay {
+			base = policy.MaxDelay
+		}
+		for i := 0; i < 100; i++ {
+			got := policy.Delay(attempt)
+			if got < base*8/10 || got > base*12/10 {
+				t.Fatalf("Delay(%d) = %s, want %s ±20%%", attempt, got, base)
+			}
+		}
+	}
+}
+
+func TestAbandoned(t *testing.T) {
+	var errSend = errors.New("send failed")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	var tests = []struct {
+		name      string
+		ctx       context.Context
+		err       error
+		permanent bool
+	}{
+		{"no error", cancelled, nil, false},
+		{"not cancelled", context.Background(), errSend, false},
+		{"cancelled", cancelled, errSend, true},
+		{"permanent", context.Background(), Permanent(errSend), true},
+	}
+	for _, test := range tests {
+		err := Abandoned(test.ctx, test.err)
+		if (err == nil) != (test.err == nil) || IsPermanent(err) != test.permanent {
+			t.Errorf("%s: Abandoned = %v, want permanent %v", test.name, err, test.permanent)
+		}
+		if test.err != nil && !errors.Is(err, errSend) {
+			t.Errorf("%s: Abandoned = %v should wrap the send error", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package worker
+
+import (
+	"context"
+	"github.com/Lupino/go-periodic"
+	pusherLib "github.com/Lupino/pusher"
+	"sync"
+	"time"
+)
+
+// lifecycle the running state shared by the copies of a worker
+type lifecycle struct {
+	locker   sync.Mutex
+	draining bool
+	inflight sync.WaitGroup
+	funcs    []periodicFunc
+	// senders the names of the running senders
+	senders []string
+	stop    chan struct{}
+	// ctx the base context of the sends, cancelled when the shutdown deadline exceeded
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// periodicFunc a func registered on the periodic worker
+type periodicFunc struct {
+	pw   *periodic.Worker
+	name string
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &lifecycle{
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// enter a job, return false when the worker is draining
+func (l *lifecycle) enter() bool {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+	if l.draining {
+		return false
+	}
+	l.inflight.Add(1)
+	return true
+}
+
+func (l *lifecycle) leave() {
+	l.inflight.Done()
+}
+
+// interrupted the in-flight sends are cancelled by the shutdown
+func (l *lifecycle) interrupted() bool {
+	return l.ctx.Err() != nil
+}
+
+// Run register the periodic func of every priority and tenant for each sender wrapped by the middlewares,
+// then work until the ctx is done or the periodic worker stop. Call Shutdown to drain the in-flight jobs.
+func (w Worker) Run(ctx context.Context, senders ...SenderV2) error {
+	w.checkPools(senders)
+	for _, sender := range senders {
+		w.life.locker.Lock()
+		w.life.senders = append(w.life.senders, sender.GetName())
+		w.life.locker.Unlock()
+		wrapped := w.wrap(sender)
+		for _, priority := range pusherLib.Priorities {
+			pw, err := w.periodicWorker(sender.GetName(), priority)
+			if err != nil {
+				return err
+			}
+			for _, tenant := range append([]string{""}, w.tenants...) {
+				funcName := pusherLib.FuncName(pusherLib.TenantPrefix(w.prefix, tenant), sender.GetName(), priority)
+				if err := pw.AddFunc(funcName, warperSender(w, wrapped, tenant, priority)); err != nil {
+					return err
+				}
+				w.life.locker.Lock()
+				w.life.funcs = append(w.life.funcs, periodicFunc{pw: pw, name: funcName})
+				w.life.locker.Unlock()
+			}
+		}
+		w.logger.Info("Loaded sender", "sender", sender.GetName())
+	}
+	go w.announce(senders)
+	if w.cacheSync > 0 {
+		go w.api.SyncCache(ctx, w.cacheSync)
+	}
+
+	// stop when any periodic worker stop, the periodic worker of New is not started without funcs
+	var done = make(chan struct{}, 1)
+	for _, pw := range w.periodicWorkers() {
+		go func(pw *periodic.Worker) {
+			pw.Work()
+			select {
+			case done <- struct{}{}:
+			default:
+			}
+		}(pw)
+	}
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+	return nil
+}
+
+// shutdownGrace how long Shutdown wait the cancelled sends to reschedule their jobs, then the queued reports
+const shutdownGrace = 5 * time.Second
+
+// Shutdown stop taking new jobs, then wait the in-flight sends and the queued reports until the ctx is done.
+// The in-flight sends are cancelled when the ctx is done, and waited with the reports for a short grace,
+// the cancelled jobs are rescheduled without counting the attempt, return the ctx error.
+func (w Worker) Shutdown(ctx context.Context) error {
+	w.life.locker.Lock()
+	if w.life.draining {
+		w.life.locker.Unlock()
+		return nil
+	}
+	w.life.draining = true
+	close(w.life.stop)
+	funcs := w.life.funcs
+	w.life.locker.Unlock()
+
+	for _, f := range funcs {
+		if err := f.pw.RemoveFunc(f.name); err != nil {
+			w.logger.Error("periodic.Worker.RemoveFunc() failed", "func", f.name, "err", err)
+		}
+	}
+
+	var done = make(chan struct{})
+	go func() {
+		w.life.inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		if !w.reports.drain(ctx) {
+			w.logger.Error("the queued reports not finished before the shutdown deadline")
+			return ctx.Err()
+		}
+		return nil
+	case <-ctx.Done():
+	}
+	// cancel the in-flight sends, wait them to reschedule the jobs
+	w.life.cancel()
+	select {
+	case <-done:
+	case <-time.After(shutdownGrace):
+		w.logger.Error("the in-flight sends not return after cancelled", "grace", shutdownGrace)
+	}
+	graceCtx, cancel := context.WithTimeout(context.Background(), shutdownGrace)
+	defer cancel()
+	if !w.reports.drain(graceCtx) {
+		w.logger.Error("the queued reports not finished after cancelled", "grace", shutdownGrace)
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,123 @@
+package worker
+
+import (
+	"context"
+	"github.com/Lupino/go-periodic"
+	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newTestJob create a periodic job of the pusher 4711
+func newTestJob() periodic.Job {
+	var payload = utils.Payload{Data: "hello"}
+	return periodic.Job{
+		Name: utils.GeneratePayloadName("4711", payload),
+		Args: utils.EncodePayload(payload),
+	}
+}
+
+// newTestWorker create a worker on a pusher server accept every report
+func newTestWorker(t *testing.T) Worker {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+	return New(nil, srv.Listener.Addr().String(), "", "")
+}
+
+func TestLifecycle(t *testing.T) {
+	var l = newLifecycle()
+	if !l.enter() {
+		t.Fatal("enter should succeed before draining")
+	}
+	l.leave()
+	l.draining = true
+	if l.enter() {
+		t.Fatal("enter should fail while draining")
+	}
+	if l.interrupted() {
+		t.Fatal("the sends should not be interrupted before cancelled")
+	}
+	l.cancel()
+	if !l.interrupted() {
+		t.Fatal("the sends should be interrupted after cancelled")
+	}
+}
+
+func TestShutdownWaitInflight(t *testing.T) {
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	w := newTestWorker(t)
+	sender := SenderFunc("sendmail", func(ctx context.Context, job Job) (int, error) {
+		close(started)
+		<-release
+		return 0, nil
+	})
+	var ack testAcker
+	var handled = make(chan struct{})
+	go func() {
+		jobHandler(w, sender, "", pusherLib.PriorityNormal)(newTestJob(), &ack)
+		close(handled)
+	}()
+	<-started
+
+	var shutdown = make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- w.Shutdown(ctx)
+	}()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("the shutdown should wait the in-flight send, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the job taken while draining is left to the other workers
+	var later testAcker
+	jobHandler(w, sender, "", pusherLib.PriorityNormal)(newTestJob(), &later)
+	if later.done || later.later != 1 {
+		t.Errorf("the job taken while draining should be scheduled later, got %+v", later)
+	}
+
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	<-handled
+	if !ack.done {
+		t.Error("the in-flight job should be done")
+	}
+	if err := w.Shutdown(context.Background()); err != nil {
+		t.Errorf("the second shutdown should return nil, got %v", err)
+	}
+}
+
+func TestShutdownCancelInflight(t *testing.T) {
+	var started = make(chan struct{})
+	w := newTestWorker(t)
+	sender := SenderFunc("sendmail", func(ctx context.Context, job Job) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	var ack testAcker
+	go jobHandler(w, sender, "", pusherLib.PriorityNormal)(newTestJob(), &ack)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := w.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("the shutdown should return the deadline, got %v", err)
+	}
+	// the cancelled send is rescheduled without counting the attempt
+	if ack.done || ack.later != 1 {
+		t.Errorf("the cancelled job should be scheduled later, got %+v", ack)
+	}
+}
@@ -1,12 +1,103 @@
 package worker
 
+import (
+	"context"
+	"errors"
+	pusherLib "github.com/Lupino/pusher"
+)
+
 // Sender interface for pusher
 type Sender interface {
 	// GetName for the periodic funcName
 	GetName() string
 	// Send message to pusher then return sendlater
-	// if err != nil job fail
+	// if err is a PermanentError job fail without retry
+	// if err != nil retry with the sender RetryPolicy
 	// if sendlater > 0 send later
 	// if sendlater == 0 send done
 	Send(pusher, data string, counter int) (sendlater int, err error)
 }
+
+// TenantSender is an optional interface for Sender to send the pushers of a tenant
+type TenantSender interface {
+	// SendTenant same as Send, the tenant is empty for the default tenant
+	SendTenant(tenant, pusher, data string, counter int) (sendlater int, err error)
+}
+
+// ErrTenantNotSupported the Sender is not a TenantSender but the job is from a tenant
+var ErrTenantNotSupported = errors.New("sender not support tenant")
+
+// Job the descriptor of a push job for SenderV2
+type Job struct {
+	// Name the periodic job name
+	Name   string
+	Sender string
+	// Tenant the tenant of the pusher, empty for the default tenant
+	Tenant string
+	Pusher string
+	Data   string
+	// Attempt the attempt of the job, start from 1
+	Attempt  int
+	Priority string
+	// SchedAt the unix time the job is scheduled
+	SchedAt int64
+	// ExpiresAt the unix time the job is useless, 0 is never expires
+	ExpiresAt int64
+	// Meta the metadata of the push
+	Meta map[string]string
+	// Trace the trace context of the push, see the tracing package
+	Trace map[string]string
+	// Snapshot the newest of the pusher snapshot at submit time and the cached pusher,
+	// nil if the server not embed the snapshot
+	Snapshot *pusherLib.Pusher
+}
+
+// SenderV2 interface for pusher with the context and the job descriptor
+type SenderV2 interface {
+	// GetName for the periodic funcName
+	GetName() string
+	// SendJob send the job then return sendlater same as Sender.Send,
+	// the ctx is done when the sender timeout or the worker shutdown
+	SendJob(ctx context.Context, job Job) (sendlater int, err error)
+}
+
+// senderAdapter adapt a Sender to SenderV2, the ctx is ignored
+type senderAdapter struct {
+	sender Sender
+}
+
+// AdaptSender adapt a Sender to SenderV2, return itself if the Sender is a SenderV2.
+// The adapted sender can't be cancelled, it run until the Sender.Send return.
+func AdaptSender(sender Sender) SenderV2 {
+	if s, ok := sender.(SenderV2); ok {
+		return s
+	}
+	return senderAdapter{sender: sender}
+}
+
+func (s senderAdapter) GetName() string {
+	return s.sender.GetName()
+}
+
+func (s senderAdapter) SendJob(ctx context.Context, job Job) (int, error) {
+	if ts, ok := s.sender.(TenantSender); ok {
+		return ts.SendTenant(job.Tenant, job.Pusher, job.Data, job.Attempt-1)
+	}
+	if job.Tenant != "" {
+		return 0, Permanent(ErrTenantNotSupported)
+	}
+	return s.sender.Send(job.Pusher, job.Data, job.Attempt-1)
+}
+
+func (s senderAdapter) Describe() pusherLib.SenderInfo {
+	if d, ok := s.sender.(Describer); ok {
+		return d.Describe()
+	}
+	return pusherLib.SenderInfo{}
+}
+
+// Describer is an optional interface for Sender to announce the capability metadata
+type Describer interface {
+	// Describe the sender, the name is always from GetName
+	Describe() pusherLib.SenderInfo
+}
@@ -1,9 +1,14 @@
 package senders
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Lupino/pusher/tracing"
 	"github.com/Lupino/pusher/utils"
 	"github.com/Lupino/pusher/worker"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -16,6 +21,7 @@ type HookSender struct {
 	name   string
 	url    string
 	secret string
+	legacy bool
 	w      worker.Worker
 }
 
@@ -29,6 +35,11 @@ func NewHookSender(w worker.Worker, name, url, secret string) HookSender {
 	}
 }
 
+// SetLegacySign sign the hook request with the legacy HmacMD5 signature
+func (s *HookSender) SetLegacySign(legacy bool) {
+	s.legacy = legacy
+}
+
 // GetName for the periodic funcName
 func (s HookSender) GetName() string {
 	return s.name
@@ -36,42 +47,79 @@ func (s HookSender) GetName() string {
 
 // Send message to pusher then return sendlater
 func (s HookSender) Send(pusher, data string, counter int) (int, error) {
+	return s.SendTenant("", pusher, data, counter)
+}
+
+// SendTenant send message to the pusher of a tenant then return sendlater
+func (s HookSender) SendTenant(tenant, pusher, data string, counter int) (int, error) {
+	return s.SendJob(context.Background(), worker.Job{Tenant: tenant, Pusher: pusher, Data: data, Attempt: counter + 1})
+}
+
+// SendJob send the job to the hook then return sendlater,
+// the hook receive the tenant, the attempt and the meta with the form fields
+func (s HookSender) SendJob(ctx context.Context, job worker.Job) (later int, err error) {
+	ctx, span := tracing.Start(ctx, "hook "+s.name, trace.SpanKindClient, attribute.String("hook.url", s.url))
+	defer func() {
+		tracing.End(span, err)
+	}()
 	var (
-		rsp        *http.Response
-		err        error
-		form       = url.Values{}
-		signParams = make(map[string]string)
-		timestamp  = strconv.FormatInt(time.Now().Unix(), 10)
-		req        *http.Request
-		sign       string
+		rsp       *http.Response
+		form      = url.Values{}
+		timestamp = strconv.FormatInt(time.Now().Unix(), 10)
+		req       *http.Request
+		body      string
 	)
 
 	form.Set("sender", s.name)
-	form.Set("pusher", pusher)
-	form.Set("data", data)
+	form.Set("pusher", job.Pusher)
+	form.Set("data", job.Data)
+	form.Set("attempt", strconv.Itoa(job.Attempt))
+	if job.Tenant != "" {
+		form.Set("tenant", job.Tenant)
+	}
+	if len(job.Meta) > 0 {
+		meta, _ := json.Marshal(job.Meta)
+		form.Set("meta", string(meta))
+	}
+	body = form.Encode()
 
-	req, _ = http.NewRequest("POST", s.url, strings.NewReader(form.Encode()))
+	if req, err = http.NewRequestWithContext(ctx, "POST", s.url, strings.NewReader(body)); err != nil {
+		worker.JobLogger(ctx).Error("http.NewRequestWithContext() failed", "err", err)
+		return 0, worker.Permanent(err)
+	}
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("X-Request-Time", timestamp)
+	tracing.InjectHeader(ctx, req.Header)
 
-	signParams["timestamp"] = timestamp
-
-	for key := range form {
-		signParams[key] = form.Get(key)
+	if s.legacy {
+		var signParams = make(map[string]string)
+		signParams["timestamp"] = timestamp
+		for key := range form {
+			signParams[key] = form.Get(key)
+		}
+		req.Header.Add("X-Request-Signature", utils.HmacMD5(s.secret, signParams))
+	} else {
+		var nonce = utils.Nonce()
+		req.Header.Add("X-Request-Nonce", nonce)
+		req.Header.Add("X-Signature-Version", utils.SignVersion)
+		sign := utils.HmacSHA256(s.secret, "POST", req.URL.Path, req.URL.Query(), []byte(body), timestamp, nonce)
+		req.Header.Add("X-Request-Signature", sign)
 	}
 
-	sign = utils.HmacMD5(s.secret, signParams)
-	req.Header.Add("X-Request-Signature", sign)
-
 	if rsp, err = http.DefaultClient.Do(req); err != nil {
-		log.Printf("http.DefaultClient.Do() failed (%s)", err)
-		return 0, nil
+		worker.JobLogger(ctx).Error("http.DefaultClient.Do() failed", "err", err)
+		// the hook may receive the request when the ctx is done, retry may post it twice
+		return 0, worker.Abandoned(ctx, err)
 	}
 	defer rsp.Body.Close()
 	if int(rsp.StatusCode/100) != 2 {
-		log.Printf("senders.HookSender(%s).Send() failed (%d)", s.name, rsp.StatusCode)
-		log.Printf("senders.HookSender(%s).Send() retry send later (%ss)", s.name, 10*counter)
-		return 10 * counter, nil
+		worker.JobLogger(ctx).Error("senders.HookSender.Send() failed", "hook", s.name, "status", rsp.StatusCode)
+		err = fmt.Errorf("hook %s reply %d", s.name, rsp.StatusCode)
+		// the hook reject the request, retry never succeed
+		if rsp.StatusCode/100 == 4 && rsp.StatusCode != http.StatusTooManyRequests {
+			return 0, worker.Permanent(err)
+		}
+		return 0, err
 	}
 	return 0, nil
 }
@@ -1,10 +1,14 @@
 package senders
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/client"
 	"github.com/Lupino/pusher/worker"
-	"log"
+	"net/http"
+	"strconv"
 )
 
 // PushAllSender a pushall sender to process pushall api
@@ -26,18 +30,31 @@ func (PushAllSender) GetName() string {
 
 // Send message to pusher then return sendlater
 func (s PushAllSender) Send(sender, data string, counter int) (int, error) {
+	return s.SendTenant("", sender, data, counter)
+}
+
+// SendTenant push message to the pushers of a tenant then return sendlater
+func (s PushAllSender) SendTenant(tenant, sender, data string, counter int) (int, error) {
+	return s.SendJob(context.Background(), worker.Job{Tenant: tenant, Pusher: sender, Data: data, Attempt: counter + 1})
+}
+
+// SendJob push message to the pushers of the sender then return sendlater,
+// the job pusher is the sender of the pushall.
+// The pushers already handled are saved as the progress of the job, a retried job resume from it.
+// A push rejected by the quota or the rate limit is retried later, the other rejected pushes are counted as failed.
+func (s PushAllSender) SendJob(ctx context.Context, job worker.Job) (later int, err error) {
 	var (
-		err      error
+		sender   = job.Pusher
 		pushers  []pusherLib.Pusher
 		total    int
-		from     = 0
 		size     = 10
 		query    = make(map[string]interface{})
 		workdata map[string]string
+		progress worker.Progress
 	)
-	if err = json.Unmarshal([]byte(data), &workdata); err != nil {
-		log.Printf("json.Unmarshal() failed (%s)", err)
-		return 0, nil
+	if err = json.Unmarshal([]byte(job.Data), &workdata); err != nil {
+		worker.JobLogger(ctx).Error("json.Unmarshal() failed", "err", err)
+		return 0, worker.Permanent(err)
 	}
 
 	if tag, ok := workdata["tag"]; ok && len(tag) > 0 {
@@ -51,21 +68,74 @@ func (s PushAllSender) Send(sender, data string, counter int) (int, error) {
 
 	q, _ := json.Marshal(query)
 
-	api := s.w.GetAPI()
-	if total, pushers, err = api.SearchPusher(string(q), from, size); err != nil {
-		return 10 * counter, nil
+	var opts = client.PushOptions{Priority: workdata["priority"], Meta: job.Meta}
+	opts.ExpiresAt, _ = strconv.ParseInt(workdata["expiresAt"], 10, 64)
+
+	api := s.w.GetTenantAPI(job.Tenant).WithContext(ctx)
+	if progress, err = s.lastProgress(api, job); err != nil {
+		return 0, err
+	}
+	defer func() {
+		worker.SetProgress(ctx, progress)
+	}()
+
+	for from := progress.Offset; ; from = from + size {
+		if total, pushers, err = api.SearchPusher(string(q), from, size); err != nil {
+			return 0, err
+		}
+		if from >= total || len(pushers) == 0 {
+			break
+		}
+		for _, pusher := range pushers {
+			if later, err = s.push(ctx, api, sender, pusher.ID, workdata["data"], opts, &progress); later > 0 || err != nil {
+				return later, err
+			}
+		}
 	}
-	s.pushs(sender, pushers, workdata["data"])
-	for from = size; from < total; from = from + size {
-		_, pushers, _ = api.SearchPusher(string(q), from, size)
-		s.pushs(sender, pushers, workdata["data"])
+	if progress.Failed > 0 {
+		worker.JobLogger(ctx).Warn("pushall finished with failed pushers", "failed", progress.Failed, "total", progress.Offset)
 	}
 	return 0, nil
 }
 
-func (s PushAllSender) pushs(sender string, pushers []pusherLib.Pusher, data string) {
-	api := s.w.GetAPI()
-	for _, pusher := range pushers {
-		api.Push(sender, pusher.ID, data, "0")
+// lastProgress return the progress saved by the last attempt of the job
+func (s PushAllSender) lastProgress(api client.PusherClient, job worker.Job) (worker.Progress, error) {
+	if job.Name == "" || job.Attempt <= 1 {
+		return worker.Progress{}, nil
+	}
+	status, err := api.GetDeliveryStatus(s.GetName(), job.Name)
+	if err != nil {
+		var se client.StatusError
+		if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+			return worker.Progress{}, nil
+		}
+		return worker.Progress{}, err
 	}
+	if status.Status != pusherLib.DeliveryRetry {
+		return worker.Progress{}, nil
+	}
+	return worker.Progress{Offset: status.Offset, Failed: status.Failed}, nil
+}
+
+// push the message to a pusher, the pusher is handled if it is pushed or rejected,
+// return sendlater when it is rejected by the quota or the rate limit
+func (s PushAllSender) push(ctx context.Context, api client.PusherClient, sender, pusher, data string, opts client.PushOptions, progress *worker.Progress) (int, error) {
+	_, err := api.PushWithOptions(sender, pusher, data, "0", opts)
+	var se client.StatusError
+	switch {
+	case err == nil:
+	case errors.As(err, &se) && se.StatusCode == http.StatusTooManyRequests:
+		if se.RetryAfter < 1 {
+			se.RetryAfter = 1
+		}
+		worker.JobLogger(ctx).Warn("pushall is rejected, retry later", "pusher", pusher, "err", err, "retryAfter", se.RetryAfter)
+		return se.RetryAfter, nil
+	case errors.As(err, &se) && se.StatusCode/100 == 4:
+		worker.JobLogger(ctx).Warn("pushall to pusher failed", "pusher", pusher, "err", err)
+		progress.Failed++
+	default:
+		return 0, err
+	}
+	progress.Offset++
+	return 0, nil
 }
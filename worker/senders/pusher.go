@@ -0,0 +1,18 @@
+package senders
+
+import (
+	"context"
+	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/tracing"
+	"github.com/Lupino/pusher/worker"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// getPusher get the pusher of the job from the pusher server in a child span
+func getPusher(ctx context.Context, w worker.Worker, job worker.Job) (pusherLib.Pusher, error) {
+	ctx, span := tracing.Start(ctx, "GetPusher", trace.SpanKindClient, attribute.String("pusher.pusher", job.Pusher))
+	p, err := w.GetTenantAPI(job.Tenant).WithContext(ctx).GetPusher(job.Pusher)
+	tracing.End(span, err)
+	return p, err
+}
@@ -0,0 +1,192 @@
+package senders
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/worker"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// blockingServer hold the requests until the test end, cancel the ctx when a request is received
+func blockingServer(t *testing.T, cancel context.CancelFunc) *httptest.Server {
+	var release = make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cancel()
+		<-release
+	}))
+	t.Cleanup(func() {
+		close(release)
+		srv.Close()
+	})
+	return srv
+}
+
+func TestHookSenderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := blockingServer(t, cancel)
+	hook := NewHookSender(worker.Worker{}, "hook1", srv.URL, "secret")
+	_, err := hook.SendJob(ctx, worker.Job{Pusher: "4711", Data: "hello", Attempt: 1})
+	if err == nil || !worker.IsPermanent(err) {
+		t.Fatalf("the cancelled hook may be delivered, it should fail without retry, got %v", err)
+	}
+}
+
+func TestHookSenderRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	hook := NewHookSender(worker.Worker{}, "hook1", srv.URL, "secret")
+	_, err := hook.SendJob(context.Background(), worker.Job{Pusher: "4711", Data: "hello", Attempt: 1})
+	if err == nil || worker.IsPermanent(err) {
+		t.Fatalf("the unavailable hook should be retried, got %v", err)
+	}
+}
+
+func TestSMSSenderCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	srv := blockingServer(t, cancel)
+	defer func(root string) { apiRoot = root }(apiRoot)
+	apiRoot = srv.URL
+
+	sender := NewSMSSender(worker.Worker{}, "key", "secret")
+	_, err := sender.SendJob(ctx, worker.Job{
+		Pusher:   "4711",
+		Data:     `{"template": "SMS_1", "signName": "pusher"}`,
+		Attempt:  1,
+		Snapshot: &pusherLib.Pusher{ID: "4711", PhoneNumber: "12345678901"},
+	})
+	if err == nil || !worker.IsPermanent(err) {
+		t.Fatalf("the cancelled sms may be sent, it should fail without retry, got %v", err)
+	}
+}
+
+// pushallServer a pusher server with the pushers p00..p24, reject the pushers by the status code of rejects,
+// the pushall job has the saved progress of status
+func pushallServer(t *testing.T, status pusherLib.DeliveryStatus, rejects map[string]int) (*httptest.Server, *[]string) {
+	var (
+		locker sync.Mutex
+		pushed []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == "/pusher/search/":
+			from, _ := strconv.Atoi(req.URL.Query().Get("from"))
+			size, _ := strconv.Atoi(req.URL.Query().Get("size"))
+			var pushers = []pusherLib.Pusher{}
+			for i := from; i < 25 && i < from+size; i++ {
+				pushers = append(pushers, pusherLib.Pusher{ID: fmt.Sprintf("p%02d", i)})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"pushers": pushers, "total": 25})
+		case req.URL.Path == "/pusher/pushall/status":
+			if status.Name == "" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]pusherLib.DeliveryStatus{"status": status})
+		case req.URL.Path == "/pusher/sendmail/push":
+			req.ParseForm()
+			var pusher = req.Form.Get("pusher")
+			if code, ok := rejects[pusher]; ok {
+				if code == http.StatusTooManyRequests {
+					w.Header().Set("Retry-After", "30")
+				}
+				w.WriteHeader(code)
+				return
+			}
+			locker.Lock()
+			pushed = append(pushed, pusher)
+			locker.Unlock()
+			json.NewEncoder(w).Encode(map[string]string{"name": pusher})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &pushed
+}
+
+func TestPushAllSender(t *testing.T) {
+	var tests = []struct {
+		name     string
+		status   pusherLib.DeliveryStatus
+		attempt  int
+		rejects  map[string]int
+		later    int
+		progress worker.Progress
+		pushed   int
+		first    string
+	}{
+		{
+			name:     "push all",
+			attempt:  1,
+			progress: worker.Progress{Offset: 25},
+			pushed:   25,
+			first:    "p00",
+		},
+		{
+			name:     "resume from the saved offset",
+			status:   pusherLib.DeliveryStatus{Name: "sendmail_1", Status: pusherLib.DeliveryRetry, Offset: 12, Failed: 1},
+			attempt:  2,
+			progress: worker.Progress{Offset: 25, Failed: 1},
+			pushed:   13,
+			first:    "p12",
+		},
+		{
+			name:     "restart the sent job",
+			status:   pusherLib.DeliveryStatus{Name: "sendmail_1", Status: pusherLib.DeliverySent, Offset: 25},
+			attempt:  2,
+			progress: worker.Progress{Offset: 25},
+			pushed:   25,
+			first:    "p00",
+		},
+		{
+			name:     "retry later the rejected by quota",
+			attempt:  1,
+			rejects:  map[string]int{"p15": http.StatusTooManyRequests},
+			later:    30,
+			progress: worker.Progress{Offset: 15},
+			pushed:   15,
+			first:    "p00",
+		},
+		{
+			name:     "count the failed",
+			attempt:  1,
+			rejects:  map[string]int{"p03": http.StatusUnprocessableEntity, "p04": http.StatusNotFound},
+			progress: worker.Progress{Offset: 25, Failed: 2},
+			pushed:   23,
+			first:    "p00",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, pushed := pushallServer(t, test.status, test.rejects)
+			sender := NewPushAllSender(worker.New(nil, srv.Listener.Addr().String(), "", ""))
+			var progress worker.Progress
+			later, err := sender.SendJob(worker.WithProgress(context.Background(), &progress), worker.Job{
+				Name:    "sendmail_1",
+				Pusher:  "sendmail",
+				Data:    `{"data": "hello"}`,
+				Attempt: test.attempt,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if later != test.later {
+				t.Errorf("later %d, want %d", later, test.later)
+			}
+			if progress != test.progress {
+				t.Errorf("progress %+v, want %+v", progress, test.progress)
+			}
+			if len(*pushed) != test.pushed || (*pushed)[0] != test.first {
+				t.Errorf("pushed %v, want %d pushers from %s", *pushed, test.pushed, test.first)
+			}
+		})
+	}
+}
@@ -2,27 +2,57 @@ package senders
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/tracing"
 	"github.com/Lupino/pusher/worker"
 	"github.com/sendgrid/sendgrid-go"
-	"log"
+	"go.opentelemetry.io/otel/trace"
+	"runtime/debug"
 	"text/template"
 )
 
-// MailSender a sendgrid send mail sender
-type MailSender struct {
+type mailAccount struct {
 	sg       *sendgrid.SGClient
 	from     string
 	fromName string
-	w        worker.Worker
+}
+
+// MailSender a sendgrid send mail sender
+type MailSender struct {
+	mailAccount
+	tenants map[string]mailAccount
+	w       worker.Worker
 }
 
 // NewMailSender new sendgrid send mail sender
 func NewMailSender(w worker.Worker, sg *sendgrid.SGClient, from, fromName string) MailSender {
-	return MailSender{sg: sg, from: from, fromName: fromName, w: w}
+	return MailSender{
+		mailAccount: mailAccount{sg: sg, from: from, fromName: fromName},
+		tenants:     make(map[string]mailAccount),
+		w:           w,
+	}
+}
+
+// SetTenant use the sendgrid account for the tenant,
+// the tenant without an account use the default account
+func (s MailSender) SetTenant(tenant string, sg *sendgrid.SGClient, from, fromName string) {
+	s.tenants[tenant] = mailAccount{sg: sg, from: from, fromName: fromName}
 }
 
+// MailSchema the json schema of the mail data
+const MailSchema = `{
+  "type": "object",
+  "properties": {
+    "subject": {"type": "string", "minLength": 1},
+    "text": {"type": "string", "minLength": 1},
+    "createdAt": {"type": "integer"}
+  },
+  "required": ["subject", "text"]
+}`
+
 type mail struct {
 	Subject   string `json:"subject"`
 	Text      string `json:"text"`
@@ -34,8 +64,26 @@ func (MailSender) GetName() string {
 	return "sendmail"
 }
 
+// Describe the sender capability
+func (MailSender) Describe() pusherLib.SenderInfo {
+	return pusherLib.SenderInfo{
+		Fields: []string{"email"},
+		Schema: json.RawMessage(MailSchema),
+	}
+}
+
 // Send message to pusher then return sendlater
 func (s MailSender) Send(pusher, data string, counter int) (int, error) {
+	return s.SendTenant("", pusher, data, counter)
+}
+
+// SendTenant send message to the pusher of a tenant then return sendlater
+func (s MailSender) SendTenant(tenant, pusher, data string, counter int) (int, error) {
+	return s.SendJob(context.Background(), worker.Job{Tenant: tenant, Pusher: pusher, Data: data, Attempt: counter + 1})
+}
+
+// SendJob send the mail to the pusher then return sendlater
+func (s MailSender) SendJob(ctx context.Context, job worker.Job) (int, error) {
 	var (
 		m      mail
 		err    error
@@ -45,27 +93,29 @@ func (s MailSender) Send(pusher, data string, counter int) (int, error) {
 		tpl    *template.Template
 		buffer = bytes.NewBuffer(nil)
 	)
-	if err = json.Unmarshal([]byte(data), &m); err != nil {
-		log.Printf("json.Unmarshal() failed (%s)", err)
-		return 0, nil
+	if err = json.Unmarshal([]byte(job.Data), &m); err != nil {
+		worker.JobLogger(ctx).Error("json.Unmarshal() failed", "err", err)
+		return 0, worker.Permanent(err)
 	}
 
-	if p, err = s.w.GetAPI().GetPusher(pusher); err != nil {
-		return 0, nil
+	if job.Snapshot != nil {
+		p = *job.Snapshot
+	} else if p, err = getPusher(ctx, s.w, job); err != nil {
+		return 0, err
 	}
 
 	if p.Email == "" {
-		return 0, nil
+		return 0, worker.Permanent(fmt.Errorf("pusher %s has no email", job.Pusher))
 	}
 
 	name = p.NickName
 
 	text = m.Text
 	if tpl, err = template.New("text").Parse(m.Text); err != nil {
-		log.Printf("template.New().Parse() failed (%s)", err)
+		worker.JobLogger(ctx).Error("template.New().Parse() failed", "err", err)
 	} else {
 		if err = tpl.Execute(buffer, p); err != nil {
-			log.Printf("template.Template.Execute() failed (%s)", err)
+			worker.JobLogger(ctx).Error("template.Template.Execute() failed", "err", err)
 		} else {
 			text = string(buffer.Bytes())
 		}
@@ -76,13 +126,42 @@ func (s MailSender) Send(pusher, data string, counter int) (int, error) {
 	message.AddToName(name)
 	message.SetSubject(m.Subject)
 	message.SetHTML(text)
-	message.SetFrom(s.from)
-	message.SetFromName(s.fromName)
-	err = s.sg.Send(message)
-	if err != nil {
-		log.Printf("sendgrid.SGClient.Send() failed (%s)", err)
-		log.Printf("senders.MailSender.Send() retry send later (%ss)", 10*counter)
-		return 10 * counter, nil
+	account, ok := s.tenants[job.Tenant]
+	if !ok {
+		account = s.mailAccount
+	}
+	message.SetFrom(account.from)
+	message.SetFromName(account.fromName)
+	if err = account.send(ctx, message); err != nil {
+		worker.JobLogger(ctx).Error("sendgrid.SGClient.Send() failed", "err", err)
+		return 0, err
 	}
 	return 0, nil
 }
+
+// send the mail, the sendgrid client can't be cancelled, stop waiting it when the ctx is done.
+// The abandoned request may still deliver the mail, so it fail without retry to avoid the duplicate,
+// set a timeout on the sendgrid http client to end the abandoned request.
+func (s mailAccount) send(ctx context.Context, message *sendgrid.SGMail) (err error) {
+	_, span := tracing.Start(ctx, "sendgrid.Send", trace.SpanKindClient)
+	defer func() {
+		tracing.End(span, err)
+	}()
+	var done = make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				var stack = string(debug.Stack())
+				worker.JobLogger(ctx).Error("sendgrid panic", "panic", fmt.Sprint(r), "stack", stack)
+				done <- worker.Permanent(worker.PanicError{Value: r, Stack: stack})
+			}
+		}()
+		done <- s.sg.Send(message)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return worker.Abandoned(ctx, fmt.Errorf("sendgrid not replied (%w)", ctx.Err()))
+	}
+}
@@ -2,36 +2,65 @@ package senders
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	pusherLib "github.com/Lupino/pusher"
+	"github.com/Lupino/pusher/tracing"
 	"github.com/Lupino/pusher/utils"
 	"github.com/Lupino/pusher/worker"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
 	"net/url"
+	"strings"
 	"text/template"
 	"time"
 )
 
 var apiRoot = "http://gw.api.taobao.com/router/rest"
 
-// SMSSender a alidayu sms sender
-type SMSSender struct {
+type smsAccount struct {
 	appKey    string
 	appSecret string
-	w         worker.Worker
+	signName  string
+}
+
+// SMSSender a alidayu sms sender
+type SMSSender struct {
+	smsAccount
+	tenants map[string]smsAccount
+	w       worker.Worker
 }
 
 // NewSMSSender new alidayu sms sender
 func NewSMSSender(w worker.Worker, key, secret string) SMSSender {
 	return SMSSender{
-		appKey:    key,
-		appSecret: secret,
-		w:         w,
+		smsAccount: smsAccount{appKey: key, appSecret: secret},
+		tenants:    make(map[string]smsAccount),
+		w:          w,
 	}
 }
 
+// SetTenant use the alidayu app for the tenant, the signName is used
+// when the sms data has no signName, the tenant without an app use the default app
+func (s SMSSender) SetTenant(tenant, key, secret, signName string) {
+	s.tenants[tenant] = smsAccount{appKey: key, appSecret: secret, signName: signName}
+}
+
+// SMSSchema the json schema of the sms data
+const SMSSchema = `{
+  "type": "object",
+  "properties": {
+    "phoneNumber": {"type": "string"},
+    "params": {"type": "string"},
+    "signName": {"type": "string", "minLength": 1},
+    "template": {"type": "string", "minLength": 1},
+    "createdAt": {"type": "integer"}
+  },
+  "required": ["template"]
+}`
+
 type smsObject struct {
 	PhoneNumber string `json:"phoneNumber"`
 	Params      string `json:"params"`
@@ -45,8 +74,26 @@ func (SMSSender) GetName() string {
 	return "sendsms"
 }
 
+// Describe the sender capability
+func (SMSSender) Describe() pusherLib.SenderInfo {
+	return pusherLib.SenderInfo{
+		Fields: []string{"phoneNumber"},
+		Schema: json.RawMessage(SMSSchema),
+	}
+}
+
 // Send message to pusher then return sendlater
 func (s SMSSender) Send(pusher, data string, counter int) (int, error) {
+	return s.SendTenant("", pusher, data, counter)
+}
+
+// SendTenant send message to the pusher of a tenant then return sendlater
+func (s SMSSender) SendTenant(tenant, pusher, data string, counter int) (int, error) {
+	return s.SendJob(context.Background(), worker.Job{Tenant: tenant, Pusher: pusher, Data: data, Attempt: counter + 1})
+}
+
+// SendJob send the sms to the pusher then return sendlater
+func (s SMSSender) SendJob(ctx context.Context, job worker.Job) (int, error) {
 	var (
 		sms    smsObject
 		err    error
@@ -55,14 +102,16 @@ func (s SMSSender) Send(pusher, data string, counter int) (int, error) {
 		tpl    *template.Template
 		buffer = bytes.NewBuffer(nil)
 	)
-	if err = json.Unmarshal([]byte(data), &sms); err != nil {
-		log.Printf("json.Unmarshal() failed (%s)", err)
-		return 0, nil
+	if err = json.Unmarshal([]byte(job.Data), &sms); err != nil {
+		worker.JobLogger(ctx).Error("json.Unmarshal() failed", "err", err)
+		return 0, worker.Permanent(err)
 	}
 
-	if p, err = s.w.GetAPI().GetPusher(pusher); err != nil {
-		log.Printf("worker.API.GetPusher() failed (%s)", err)
-		return 0, nil
+	if job.Snapshot != nil {
+		p = *job.Snapshot
+	} else if p, err = getPusher(ctx, s.w, job); err != nil {
+		worker.JobLogger(ctx).Error("worker.API.GetPusher() failed", "err", err)
+		return 0, err
 	}
 
 	if sms.PhoneNumber == "" {
@@ -70,30 +119,49 @@ func (s SMSSender) Send(pusher, data string, counter int) (int, error) {
 	}
 
 	if sms.PhoneNumber == "" {
-		return 0, nil
+		return 0, worker.Permanent(fmt.Errorf("pusher %s has no phone number", job.Pusher))
 	}
 
 	params = sms.Params
 	if tpl, err = template.New("smsParams").Parse(sms.Params); err != nil {
-		log.Printf("template.New().Parse() failed (%s)", err)
+		worker.JobLogger(ctx).Error("template.New().Parse() failed", "err", err)
 	} else {
 		if err = tpl.Execute(buffer, p); err != nil {
-			log.Printf("template.Template.Execute() failed (%s)", err)
+			worker.JobLogger(ctx).Error("template.Template.Execute() failed", "err", err)
 		} else {
 			params = string(buffer.Bytes())
 		}
 	}
 
-	if err = s.SendSMS(sms.PhoneNumber, params, sms.SignName, sms.Template); err != nil {
-		log.Printf("senders.SMSSender.SendSMS() failed (%s)", err)
-		log.Printf("senders.SMSSender.Send() retry send later (%ss)", 10*counter)
-		return 10 * counter, nil
+	account, ok := s.tenants[job.Tenant]
+	if !ok {
+		account = s.smsAccount
+	}
+	if sms.SignName == "" {
+		sms.SignName = account.signName
+	}
+	if sms.SignName == "" {
+		return 0, worker.Permanent(fmt.Errorf("signName is required"))
+	}
+
+	if err = account.sendSMS(ctx, sms.PhoneNumber, params, sms.SignName, sms.Template); err != nil {
+		worker.JobLogger(ctx).Error("senders.SMSSender.SendSMS() failed", "err", err)
+		// the sms may be sent when the ctx is done, retry may send it twice
+		return 0, worker.Abandoned(ctx, err)
 	}
 	return 0, nil
 }
 
 // SendSMS message
 func (s SMSSender) SendSMS(phoneNumber, smsParams, signName, template string) error {
+	return s.smsAccount.sendSMS(context.Background(), phoneNumber, smsParams, signName, template)
+}
+
+func (s smsAccount) sendSMS(ctx context.Context, phoneNumber, smsParams, signName, template string) (err error) {
+	ctx, span := tracing.Start(ctx, "alidayu.SendSMS", trace.SpanKindClient, attribute.String("sms.template", template))
+	defer func() {
+		tracing.End(span, err)
+	}()
 	params := make(map[string]string)
 	params["method"] = "alibaba.aliqin.fc.sms.num.send"
 	params["app_key"] = s.appKey
@@ -113,9 +181,15 @@ func (s SMSSender) SendSMS(phoneNumber, smsParams, signName, template string) er
 		form.Set(key, value)
 	}
 
-	rsp, err := http.PostForm(apiRoot, form)
+	req, err := http.NewRequestWithContext(ctx, "POST", apiRoot, strings.NewReader(form.Encode()))
+	if err != nil {
+		worker.JobLogger(ctx).Error("http.NewRequestWithContext() failed", "err", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rsp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Printf("http.PostForm() failed (%s)", err)
+		worker.JobLogger(ctx).Error("http.DefaultClient.Do() failed", "err", err)
 		return err
 	}
 	defer rsp.Body.Close()
@@ -123,7 +197,7 @@ func (s SMSSender) SendSMS(phoneNumber, smsParams, signName, template string) er
 	decoder := json.NewDecoder(rsp.Body)
 	var ret map[string]interface{}
 	if err = decoder.Decode(&ret); err != nil {
-		log.Printf("json.NewDecoder().Decode() failed (%s)", err)
+		worker.JobLogger(ctx).Error("json.NewDecoder().Decode() failed", "err", err)
 		return err
 	}
 	errRsp, ok := ret["error_response"]
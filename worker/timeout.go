@@ -0,0 +1,20 @@
+package worker
+
+import (
+	"time"
+)
+
+// DefaultSendTimeout the timeout of the sender without timeout
+const DefaultSendTimeout = time.Minute
+
+// SetTimeout set the timeout of a send by the sender, 0 is never timeout
+func (w *Worker) SetTimeout(sender string, timeout time.Duration) {
+	w.timeouts[sender] = timeout
+}
+
+func (w Worker) timeout(sender string) time.Duration {
+	if timeout, ok := w.timeouts[sender]; ok {
+		return timeout
+	}
+	return DefaultSendTimeout
+}
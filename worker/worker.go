@@ -1,37 +1,225 @@
 package worker
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/Lupino/go-periodic"
+	pusherLib "github.com/Lupino/pusher"
 	"github.com/Lupino/pusher/client"
+	"github.com/Lupino/pusher/tracing"
 	"github.com/Lupino/pusher/utils"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"log/slog"
+	"os"
+	"time"
 )
 
 // PREFIX the default perfix key of pusher.
 const PREFIX = "pusher:"
 
-func warperSender(w Worker, sender Sender) func(periodic.Job) {
+// jobAcker ack the periodic job, eg: periodic.Job
+type jobAcker interface {
+	Done() error
+	SchedLater(delay int, step int) error
+}
+
+func warperSender(w Worker, sender SenderV2, tenant, priority string) func(periodic.Job) {
+	handle := jobHandler(w, sender, tenant, priority)
 	return func(job periodic.Job) {
-		pusher := utils.ExtractPusher(job.Name)
-		if !utils.VerifyData(job.Name, pusher, job.Args) {
-			log.Printf("verifyData() failed (%s) ignore\n", job.Name)
-			job.Done() // ignore invalid job
+		handle(job, job)
+	}
+}
+
+// jobHandler send the periodic job of the tenant func by the sender, then ack it by the acker
+func jobHandler(w Worker, sender SenderV2, tenant, priority string) func(periodic.Job, jobAcker) {
+	return func(job periodic.Job, ack jobAcker) {
+		if !w.life.enter() {
+			// the worker is draining, leave the job to the other workers
+			ack.SchedLater(1, 0)
+			return
+		}
+		defer w.life.leave()
+
+		qualified := utils.ExtractPusher(job.Name)
+		if !utils.VerifyPayload(job.Name, qualified, job.Args) {
+			w.logger.Warn("verifyData() failed, ignore", "job", job.Name, "sender", sender.GetName())
+			w.metrics.IncJob(sender.GetName(), ResultInvalid)
+			ack.Done() // ignore invalid job
+			return
+		}
+		jobTenant, pusher := utils.SplitTenant(qualified)
+		if jobTenant != tenant {
+			// the job of a tenant is only submitted to the funcs of the tenant
+			w.logger.Warn("the job is not in the tenant of the func, ignore", "job", job.Name, "func", job.FuncName, "tenant", tenant)
+			w.metrics.IncJob(sender.GetName(), ResultInvalid)
+			ack.Done()
+			return
+		}
+		var (
+			later   int
+			err     error
+			counter = int(job.Raw.Counter)
+		)
+		var status = pusherLib.DeliveryStatus{
+			Name:    job.Name,
+			Sender:  sender.GetName(),
+			Pusher:  pusher,
+			Counter: counter,
+		}
+
+		payload := utils.DecodePayload(job.Args)
+		if payload.Expired(time.Now().Unix()) {
+			status.Status = pusherLib.DeliveryExpired
+			ack.Done()
+			w.report(tenant, status)
 			return
 		}
-		later, err := sender.Send(pusher, job.Args, int(job.Raw.Counter))
-
-		if err != nil {
-			job.Fail()
-		} else if later > 0 {
-			if w.tryTimes > uint(job.Raw.Counter) {
-				job.Done()
-				return
+
+		ret, action, taken := w.takeCap(tenant, sender.GetName(), pusher)
+		if !ret.Allowed {
+			status.Reason = "cap " + ret.Cap + " exceeded"
+			if action == CapDefer {
+				status.Status = pusherLib.DeliveryDeferred
+				if ret.RetryAfter < 1 {
+					ret.RetryAfter = 1
+				}
+				ack.SchedLater(int(ret.RetryAfter), 0)
+			} else {
+				status.Status = pusherLib.DeliveryDropped
+				ack.Done()
 			}
-			job.SchedLater(later, 1)
-		} else {
-			job.Done()
+			w.report(tenant, status)
+			return
+		}
+
+		var snapshot *pusherLib.Pusher
+		if len(payload.Pusher) > 0 {
+			var p pusherLib.Pusher
+			if json.Unmarshal(payload.Pusher, &p) == nil && p.ID == pusher {
+				p = w.GetTenantAPI(tenant).MergeSnapshot(p)
+				snapshot = &p
+			}
+		}
+
+		var progress Progress
+		later, err = w.send(sender, &progress, Job{
+			Name:      job.Name,
+			Sender:    sender.GetName(),
+			Tenant:    tenant,
+			Pusher:    pusher,
+			Data:      payload.Data,
+			Attempt:   counter + 1,
+			Priority:  priority,
+			SchedAt:   job.Raw.SchedAt,
+			ExpiresAt: payload.ExpiresAt,
+			Meta:      payload.Meta,
+			Trace:     payload.Trace,
+			Snapshot:  snapshot,
+		})
+		status.Offset, status.Failed = progress.Offset, progress.Failed
+
+		var policy = w.retryPolicy(sender.GetName())
+		var dead bool
+		switch {
+		case err != nil && !IsPermanent(err) && w.life.interrupted():
+			// the send is cancelled by the shutdown, it is not a real attempt
+			status.Status = pusherLib.DeliveryRetry
+			status.Reason = "worker shutdown"
+			ack.SchedLater(1, 0)
+		case err != nil && IsPermanent(err):
+			status.Status = pusherLib.DeliveryFailed
+			status.Reason = err.Error()
+			var pe PanicError
+			if errors.As(err, &pe) {
+				status.Reason = pe.Error() + "\n" + pe.Stack
+			}
+			dead = true
+			ack.Done()
+		case err == nil && later == 0:
+			status.Status = pusherLib.DeliverySent
+			ack.Done()
+		case policy.MaxAttempts > 0 && counter+1 >= policy.MaxAttempts:
+			status.Status = pusherLib.DeliveryFailed
+			status.Reason = "max attempts"
+			if err != nil {
+				status.Reason = "max attempts (" + err.Error() + ")"
+			}
+			dead = true
+			ack.Done()
+		default:
+			// the sender ask to send later, or retry the error with backoff
+			if err != nil {
+				status.Reason = err.Error()
+				later = int(policy.Delay(counter+1) / time.Second)
+			}
+			status.Status = pusherLib.DeliveryRetry
+			ack.SchedLater(later, 1)
+		}
+		if taken && status.Status != pusherLib.DeliverySent {
+			// only the delivered push is counted by the caps
+			w.refundCap(tenant, sender.GetName(), pusher)
+		}
+		if !dead {
+			w.report(tenant, status)
+			return
 		}
+		w.reportDead(tenant, status, client.DeadLetter{
+			Name:      job.Name,
+			Sender:    sender.GetName(),
+			Pusher:    pusher,
+			Data:      payload.Data,
+			Priority:  priority,
+			ExpiresAt: payload.ExpiresAt,
+			Meta:      payload.Meta,
+			Err:       status.Reason,
+		})
+	}
+}
+
+// send the job with the timeout of the sender, the sender save the progress by SetProgress
+func (w Worker) send(sender SenderV2, progress *Progress, job Job) (int, error) {
+	var start = time.Now()
+	w.metrics.AddInflight(sender.GetName(), 1)
+	defer w.metrics.AddInflight(sender.GetName(), -1)
+	ctx, span := tracing.Start(tracing.Extract(w.life.ctx, job.Trace), "send "+sender.GetName(), trace.SpanKindConsumer,
+		attribute.String("pusher.job", job.Name),
+		attribute.String("pusher.sender", job.Sender),
+		attribute.String("pusher.pusher", job.Pusher),
+		attribute.String("pusher.tenant", job.Tenant),
+		attribute.Int("pusher.attempt", job.Attempt),
+	)
+	ctx = w.withJobLogger(ctx, job)
+	ctx = WithProgress(ctx, progress)
+	if timeout := w.timeout(sender.GetName()); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
 	}
+	later, err := w.sendJob(ctx, sender, job)
+	w.metrics.ObserveSend(sender.GetName(), time.Since(start), err)
+	var pe PanicError
+	if errors.As(err, &pe) {
+		w.panics.incr(sender.GetName())
+	}
+	if err != nil && !IsPermanent(err) && ctx.Err() == context.DeadlineExceeded {
+		err = fmt.Errorf("sender %s timeout (%s)", sender.GetName(), err)
+	}
+	span.SetAttributes(attribute.Int("pusher.later", later))
+	tracing.End(span, err)
+	return later, err
+}
+
+// sendJob send the job, recover the panic of the sender
+func (w Worker) sendJob(ctx context.Context, sender SenderV2, job Job) (later int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			later, err = 0, recoverPanic(ctx, r)
+		}
+	}()
+	return sender.SendJob(ctx, job)
 }
 
 // Worker for pusher
@@ -40,15 +228,42 @@ type Worker struct {
 	api      client.PusherClient
 	prefix   string
 	tryTimes uint
+	id       string
+	tenants  []string
+	caps     map[string]senderCaps
+	retry    map[string]RetryPolicy
+	timeouts map[string]time.Duration
+	life     *lifecycle
+	// middlewares wrap every sender on Run
+	middlewares []Middleware
+	panics      *panicCounter
+	successes   *successTracker
+	cacheSync   time.Duration
+	pools       *pools
+	reports     *reporter
+	metrics     Metrics
+	logger      *slog.Logger
 }
 
 // New worker
 func New(w *periodic.Worker, host, key, secret string) Worker {
+	hostname, _ := os.Hostname()
 	return Worker{
-		w:        w,
-		api:      client.New(host, key, secret),
-		tryTimes: 5,
-		prefix:   PREFIX,
+		w:         w,
+		api:       client.New(host, key, secret),
+		tryTimes:  5,
+		prefix:    PREFIX,
+		id:        fmt.Sprintf("%s-%d", hostname, os.Getpid()),
+		caps:      make(map[string]senderCaps),
+		retry:     make(map[string]RetryPolicy),
+		timeouts:  make(map[string]time.Duration),
+		life:      newLifecycle(),
+		panics:    newPanicCounter(),
+		successes: newSuccessTracker(),
+		pools:     newPools(),
+		reports:   newReporter(),
+		metrics:   nopMetrics{},
+		logger:    slog.Default(),
 	}
 }
 
@@ -57,21 +272,72 @@ func (w *Worker) SetPrefix(prefix string) {
 	w.prefix = prefix
 }
 
-// SetMaxTryTimes set max try time for send failed
+// SetTenants set the tenants the worker serve besides the default tenant,
+// Run register the periodic funcs of every tenant, eg: pusher:shop:sendmail
+func (w *Worker) SetTenants(tenants ...string) {
+	w.tenants = tenants
+}
+
+// SetMaxTryTimes set the max attempts of the sender without a retry policy
 func (w *Worker) SetMaxTryTimes(tryTimes uint) {
 	w.tryTimes = tryTimes
 }
 
-// RunSender by periodic worker
+// RunSender by periodic worker, the senders are adapted to SenderV2
 func (w Worker) RunSender(senders ...Sender) {
+	var adapted = make([]SenderV2, len(senders))
+	for i, sender := range senders {
+		adapted[i] = AdaptSender(sender)
+	}
+	w.RunSenderV2(adapted...)
+}
+
+// RunSenderV2 by periodic worker, block until the periodic worker stop
+func (w Worker) RunSenderV2(senders ...SenderV2) {
+	if err := w.Run(context.Background(), senders...); err != nil {
+		w.logger.Error("worker.Worker.Run() failed", "err", err)
+	}
+}
+
+// announce the senders to the pusher server then keep heartbeat
+func (w Worker) announce(senders []SenderV2) {
+	var infos []pusherLib.SenderInfo
 	for _, sender := range senders {
-		w.w.AddFunc(w.prefix+sender.GetName(), warperSender(w, sender))
-		log.Printf("Loaded sender (%s)", sender.GetName())
+		var info pusherLib.SenderInfo
+		if d, ok := sender.(Describer); ok {
+			info = d.Describe()
+		}
+		info.Name = sender.GetName()
+		infos = append(infos, info)
 	}
-	w.w.Work()
+	for {
+		for _, info := range infos {
+			if err := w.api.AnnounceSender(info, w.id); err != nil {
+				w.logger.Error("client.PusherClient.AnnounceSender() failed", "sender", info.Name, "err", err)
+			}
+		}
+		select {
+		case <-time.After(pusherLib.SenderHeartbeat):
+		case <-w.life.stop:
+			return
+		}
+	}
+}
+
+// SetPusherCache cache the pushers of the api, set it before create the senders.
+// Run poll the pusher changes every sync to invalidate the cache, 0 only invalidate the pushers changed by the worker,
+// the worker api key must be an admin key to get the changes.
+func (w *Worker) SetPusherCache(cache client.Cache, sync time.Duration) {
+	w.api.SetCache(cache)
+	w.cacheSync = sync
 }
 
 // GetAPI return some implement pusher client api
 func (w Worker) GetAPI() client.PusherClient {
 	return w.api
 }
+
+// GetTenantAPI return the pusher client api of a tenant
+func (w Worker) GetTenantAPI(tenant string) client.PusherClient {
+	return w.api.Tenant(tenant)
+}